@@ -0,0 +1,54 @@
+package krylr896
+
+import (
+	"math"
+	"time"
+)
+
+// bandwidthHz maps the Bandwidth* constants to their bandwidth in Hz
+var bandwidthHz = [...]float64{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000, 500000}
+
+// DefaultParameters are the module's factory RF parameters, SF12 BW125KHz CR4/5 PP4
+var DefaultParameters = Parameters{
+	SpreadingFactor:    12,
+	Bandwidth:          Bandwidth125KHz,
+	CodingRate:         1,
+	ProgrammedPreamble: 4,
+}
+
+// BandwidthHz returns the bandwidth in Hz of a Bandwidth* constant, 0 if it is out of range
+func BandwidthHz(bandwidth uint8) float64 {
+	if int(bandwidth) >= len(bandwidthHz) {
+		return 0
+	}
+	return bandwidthHz[bandwidth]
+}
+
+// TimeOnAir computes how long a payload of payloadLen bytes occupies the channel with the given
+// parameters, using the Semtech formula with an explicit header and CRC enabled
+func TimeOnAir(params Parameters, payloadLen int) time.Duration {
+	bw := BandwidthHz(params.Bandwidth)
+	if bw == 0 || params.SpreadingFactor == 0 {
+		return 0
+	}
+	sf := float64(params.SpreadingFactor)
+
+	// symbol duration in seconds
+	tSym := math.Pow(2, sf) / bw
+
+	// low data rate optimisation is mandated when a symbol is longer than 16ms
+	de := 0.0
+	if tSym > 0.016 {
+		de = 1
+	}
+
+	tPreamble := (float64(params.ProgrammedPreamble) + 4.25) * tSym
+
+	// payload symbols, CRC on and explicit header
+	num := 8*float64(payloadLen) - 4*sf + 28 + 16
+	den := 4 * (sf - 2*de)
+	payloadSymbols := 8 + math.Max(math.Ceil(num/den)*(float64(params.CodingRate)+4), 0)
+
+	seconds := tPreamble + payloadSymbols*tSym
+	return time.Duration(seconds * float64(time.Second))
+}
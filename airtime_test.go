@@ -0,0 +1,25 @@
+package krylr896
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimeOnAir checks the airtime formula against published reference values
+func TestTimeOnAir(t *testing.T) {
+	cases := []struct {
+		params Parameters
+		length int
+		want   time.Duration
+	}{
+		{Parameters{SpreadingFactor: 7, Bandwidth: Bandwidth125KHz, CodingRate: 1, ProgrammedPreamble: 8}, 10, 41216 * time.Microsecond},
+		{Parameters{SpreadingFactor: 12, Bandwidth: Bandwidth125KHz, CodingRate: 1, ProgrammedPreamble: 8}, 10, 991232 * time.Microsecond},
+	}
+
+	for _, tc := range cases {
+		got := TimeOnAir(tc.params, tc.length)
+		if diff := got - tc.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("TimeOnAir(%+v, %d) = %v, want %v", tc.params, tc.length, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package krylr896
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TxReport describes how a message sent with SendAsync went
+type TxReport struct {
+	Enqueued time.Time     // when SendAsync was called
+	Written  time.Time     // when AT+SEND was written to the port, zero if it never was
+	Acked    time.Time     // when the module answered, zero if it did not
+	Measured time.Duration // from Written to Acked, zero without both
+	Computed time.Duration // time on air for the encoded payload, zero if the RF parameters are unknown
+	Error    *ErrorEvent   // nil on success, Code holds the module's error such as TX_OT or TX_OR
+}
+
+// SendTicket resolves with the TxReport of a message sent with SendAsync
+type SendTicket struct {
+	done   chan struct{}
+	mu     sync.Mutex
+	report TxReport
+}
+
+// Done is closed once the report is complete
+func (t *SendTicket) Done() <-chan struct{} {
+	return t.done
+}
+
+// Report returns the report so far, it is complete once Done is closed
+func (t *SendTicket) Report() TxReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.report
+}
+
+// Wait blocks until the report is complete or ctx ends
+func (t *SendTicket) Wait(ctx context.Context) (TxReport, error) {
+	select {
+	case <-t.done:
+		return t.Report(), nil
+	case <-ctx.Done():
+		return t.Report(), ctx.Err()
+	}
+}
+
+// resolve completes the ticket
+func (t *SendTicket) resolve(errEvent *ErrorEvent) {
+	t.mu.Lock()
+	t.report.Error = errEvent
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// parameters returns the RF parameters last applied
+func (Lora *lora) parameters() (Parameters, bool) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	if Lora.params == nil {
+		return Parameters{}, false
+	}
+	return *Lora.params, true
+}
+
+// SendAsync queues bytes for the specified address and returns straight away, the ticket resolves when
+// the module has answered or the message could not be sent
+func (Lora *lora) SendAsync(address uint16, data []byte, opts SendOptions) *SendTicket {
+	ticket := &SendTicket{done: make(chan struct{})}
+	ticket.report.Enqueued = time.Now()
+
+	if limit := Lora.MaxPayload(); len(data) > limit {
+		ticket.resolve(&ErrorEvent{Code: nil, Err: fmt.Errorf("data length %d exceeds maximum of %d bytes", len(data), limit)})
+		return ticket
+	}
+	if codec := Lora.payloadCodec(); codec != nil {
+		data = codec.Encode(data)
+	}
+	if params, ok := Lora.parameters(); ok {
+		ticket.report.Computed = TimeOnAir(params, len(data))
+	}
+
+	cmd := Command{
+		Text:     fmt.Sprintf("AT+SEND=%d,%d,%s", address, len(data), string(data)),
+		Priority: opts.Priority,
+		Deadline: opts.Deadline,
+		onWritten: func(written time.Time) {
+			ticket.mu.Lock()
+			ticket.report.Written = written
+			ticket.mu.Unlock()
+		},
+		onDone: func(resp CommandResponse) {
+			ticket.mu.Lock()
+			if !ticket.report.Written.IsZero() && (resp.Error == nil || resp.Error.Code != nil) {
+				ticket.report.Acked = time.Now()
+				ticket.report.Measured = ticket.report.Acked.Sub(ticket.report.Written)
+			}
+			ticket.mu.Unlock()
+
+			if resp.Error != nil {
+				if resp.Error.Err != nil {
+					ticket.resolve(&ErrorEvent{Code: resp.Error.Code, Err: fmt.Errorf("send failed: %w", resp.Error.Err)})
+					return
+				}
+				ticket.resolve(&ErrorEvent{Code: resp.Error.Code, Err: fmt.Errorf("send failed")})
+				return
+			}
+			ticket.resolve(nil)
+		},
+	}
+	Lora.queue.push(cmd)
+
+	return ticket
+}
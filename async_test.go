@@ -0,0 +1,52 @@
+package krylr896
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestSendAsync pipelines messages and checks their transmit reports
+func TestSendAsync(t *testing.T) {
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultSpuriousError, Match: "+OK", Nth: 4, Code: TX_OT})
+
+	params := Parameters{SpreadingFactor: 7, Bandwidth: Bandwidth125KHz, CodingRate: 1, ProgrammedPreamble: 4}
+	if err := lora.SetConfig(Configuration{Parameter: &params}); err != nil {
+		t.Fatalf("Failed to set parameters: %v", err.Err)
+	}
+
+	var tickets []*SendTicket
+	for _, data := range []string{"one", "two", "three"} {
+		tickets = append(tickets, lora.SendAsync(2, []byte(data), SendOptions{}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i, ticket := range tickets {
+		report, err := ticket.Wait(ctx)
+		if err != nil {
+			t.Fatalf("ticket %d: %v", i, err)
+		}
+		if i < 2 {
+			if report.Error != nil {
+				t.Fatalf("ticket %d failed: %v", i, report.Error.Err)
+			}
+			if report.Written.Before(report.Enqueued) || report.Acked.Before(report.Written) ||
+				report.Measured != report.Acked.Sub(report.Written) {
+				t.Fatalf("ticket %d: inconsistent times: %+v", i, report)
+			}
+			if report.Computed != TimeOnAir(params, len(module.Sent()[i].Data)) {
+				t.Fatalf("ticket %d: computed %v", i, report.Computed)
+			}
+			continue
+		}
+		// the module's error code is reported
+		if report.Error == nil || report.Error.Code == nil || *report.Error.Code != TX_OT || report.Acked.IsZero() {
+			t.Fatalf("ticket %d: expected code %d, got %+v", i, TX_OT, report)
+		}
+	}
+
+	if ticket := lora.SendAsync(2, make([]byte, 241), SendOptions{}); ticket.Report().Error == nil {
+		t.Fatal("expected an oversize message to fail straight away")
+	}
+}
@@ -0,0 +1,80 @@
+package krylr896
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// PayloadCodec encodes message data into bytes the module carries safely, the AT+SEND command ends at
+// the first line ending and the module may mangle bytes outside printable ASCII
+type PayloadCodec interface {
+	Encode(data []byte) []byte
+	Decode(encoded []byte) ([]byte, error)
+	MaxDecodedLen(encodedLen int) int // largest payload whose encoding fits in encodedLen bytes
+}
+
+// Base64Codec uses standard padded base64, 180 bytes fit in a frame
+type Base64Codec struct{}
+
+// Encode returns data as base64
+func (Base64Codec) Encode(data []byte) []byte {
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	return encoded
+}
+
+// Decode reverses Encode
+func (Base64Codec) Decode(encoded []byte) ([]byte, error) {
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(data, encoded)
+	return data[:n], err
+}
+
+// MaxDecodedLen returns how many bytes encode to at most encodedLen
+func (Base64Codec) MaxDecodedLen(encodedLen int) int {
+	return encodedLen / 4 * 3
+}
+
+// HexCodec uses lowercase hex, 120 bytes fit in a frame
+type HexCodec struct{}
+
+// Encode returns data as hex
+func (HexCodec) Encode(data []byte) []byte {
+	encoded := make([]byte, hex.EncodedLen(len(data)))
+	hex.Encode(encoded, data)
+	return encoded
+}
+
+// Decode reverses Encode
+func (HexCodec) Decode(encoded []byte) ([]byte, error) {
+	data := make([]byte, hex.DecodedLen(len(encoded)))
+	n, err := hex.Decode(data, encoded)
+	return data[:n], err
+}
+
+// MaxDecodedLen returns how many bytes encode to at most encodedLen
+func (HexCodec) MaxDecodedLen(encodedLen int) int {
+	return encodedLen / 2
+}
+
+// SetPayloadCodec sets the codec applied to sent and received message data, nil sends data as is
+func (Lora *lora) SetPayloadCodec(codec PayloadCodec) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	Lora.codec = codec
+}
+
+// payloadCodec returns the codec in use, nil if none
+func (Lora *lora) payloadCodec() PayloadCodec {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	return Lora.codec
+}
+
+// MaxPayload returns the most bytes SendMessage accepts with the current codec
+func (Lora *lora) MaxPayload() int {
+	if codec := Lora.payloadCodec(); codec != nil {
+		return codec.MaxDecodedLen(maxPayload)
+	}
+	return maxPayload
+}
@@ -0,0 +1,61 @@
+package krylr896
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestPayloadCodecs round trips every byte value at the largest size that fits a frame
+func TestPayloadCodecs(t *testing.T) {
+	for _, codec := range []PayloadCodec{Base64Codec{}, HexCodec{}} {
+		data := make([]byte, codec.MaxDecodedLen(maxPayload))
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		encoded := codec.Encode(data)
+		if len(encoded) > maxPayload || bytes.ContainsAny(encoded, "\r\n,") {
+			t.Errorf("%T: unsafe encoding of %d bytes", codec, len(encoded))
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Errorf("%T: round trip failed: %v", codec, err)
+		}
+	}
+}
+
+// TestEmulatorPayloadCodec sends and receives binary data through an emulated module
+func TestEmulatorPayloadCodec(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransportWithOptions(module.Attach(), 0, Configuration{}, 10,
+		ConnectionOptions{PayloadCodec: Base64Codec{}})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	payload := []byte{0x00, '\r', '\n', 0xff, ','}
+	if sendErr := lora.SendMessage(2, payload); sendErr != nil {
+		t.Fatalf("Failed to send message: %v", sendErr.Err)
+	}
+	sent := module.Sent()
+	if len(sent) != 1 || string(sent[0].Data) != string(Base64Codec{}.Encode(payload)) {
+		t.Fatalf("unexpected frames: %+v", sent)
+	}
+
+	if sendErr := lora.SendMessage(2, make([]byte, 181)); sendErr == nil {
+		t.Fatal("expected 181 bytes to exceed the encoded limit")
+	}
+
+	module.Inject(50, Base64Codec{}.Encode(payload), -99, 40)
+	select {
+	case msg := <-lora.RecievedData:
+		if !bytes.Equal(msg.Data[:msg.Length], payload) {
+			t.Fatalf("unexpected data: %q", msg.Data[:msg.Length])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
@@ -0,0 +1,290 @@
+package krylr896
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// configCommands returns the AT commands that set the non-nil fields of config, in the order SetConfig
+// sends them
+func configCommands(config Configuration) []string {
+	var cmds []string
+	if config.Address != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+ADDRESS=%d", *config.Address))
+	}
+	if config.NetworkID != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+NETWORKID=%d", *config.NetworkID))
+	}
+	if config.Band != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+BAND=%d", *config.Band))
+	}
+	if config.Parameter != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+PARAMETER=%d,%d,%d,%d",
+			config.Parameter.SpreadingFactor,
+			config.Parameter.Bandwidth,
+			config.Parameter.CodingRate,
+			config.Parameter.ProgrammedPreamble))
+	}
+	if config.Mode != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+MODE=%d", *config.Mode))
+	}
+	if config.UartBaudRate != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+IPR=%d", *config.UartBaudRate))
+	}
+	if config.EncryptionKey != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+CPIN=%s", hex.EncodeToString(config.EncryptionKey[:])))
+	}
+	if config.RFOutputPower != nil {
+		cmds = append(cmds, fmt.Sprintf("AT+CRFOP=%d", *config.RFOutputPower))
+	}
+	return cmds
+}
+
+// mergeConfig copies the non-nil fields of src into dst, the values are copied so later changes by the
+// caller do not leak in
+func mergeConfig(dst *Configuration, src Configuration) {
+	if src.Address != nil {
+		v := *src.Address
+		dst.Address = &v
+	}
+	if src.NetworkID != nil {
+		v := *src.NetworkID
+		dst.NetworkID = &v
+	}
+	if src.Band != nil {
+		v := *src.Band
+		dst.Band = &v
+	}
+	if src.Parameter != nil {
+		v := *src.Parameter
+		dst.Parameter = &v
+	}
+	if src.Mode != nil {
+		v := *src.Mode
+		dst.Mode = &v
+	}
+	if src.UartBaudRate != nil {
+		v := *src.UartBaudRate
+		dst.UartBaudRate = &v
+	}
+	if src.EncryptionKey != nil {
+		v := *src.EncryptionKey
+		dst.EncryptionKey = &v
+	}
+	if src.RFOutputPower != nil {
+		v := *src.RFOutputPower
+		dst.RFOutputPower = &v
+	}
+}
+
+// recordApplied remembers fields the module has accepted
+func (Lora *lora) recordApplied(config Configuration) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	mergeConfig(&Lora.applied, config)
+}
+
+// appliedConfig returns every field the module has accepted so far
+func (Lora *lora) appliedConfig() Configuration {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	var config Configuration
+	mergeConfig(&config, Lora.applied)
+	return config
+}
+
+// configFields are the query names of the Configuration fields, in the order SetConfig sends them
+var configFields = []string{"ADDRESS", "NETWORKID", "BAND", "PARAMETER", "MODE", "IPR", "CPIN", "CRFOP"}
+
+// configFieldLabels names the fields in error messages
+var configFieldLabels = map[string]string{
+	"ADDRESS":   "address",
+	"NETWORKID": "network ID",
+	"BAND":      "band",
+	"PARAMETER": "parameter",
+	"MODE":      "mode",
+	"IPR":       "UART baud rate",
+	"CPIN":      "encryption key",
+	"CRFOP":     "RF output power",
+}
+
+// ConfigParseError reports a query answer from the module that could not be parsed
+type ConfigParseError struct {
+	Field    string // query name, e.g. "PARAMETER"
+	Response string // the line the module answered with
+	Err      error  // why the value was rejected, nil if the line had the wrong form
+}
+
+func (e *ConfigParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unexpected %s answer %q: %v", e.Field, e.Response, e.Err)
+	}
+	return fmt.Sprintf("unexpected %s answer %q", e.Field, e.Response)
+}
+
+func (e *ConfigParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseConfigAnswer parses the answer to AT+<field>? into the matching field of config
+func parseConfigAnswer(config *Configuration, field string, response string) error {
+	value, found := strings.CutPrefix(response, "+"+field+"=")
+	if !found {
+		return &ConfigParseError{Field: field, Response: response}
+	}
+	fail := func(err error) error {
+		return &ConfigParseError{Field: field, Response: response, Err: err}
+	}
+
+	switch field {
+	case "ADDRESS":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fail(err)
+		}
+		address := uint16(v)
+		config.Address = &address
+	case "NETWORKID":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fail(err)
+		}
+		networkID := uint8(v)
+		config.NetworkID = &networkID
+	case "BAND":
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fail(err)
+		}
+		band := uint32(v)
+		config.Band = &band
+	case "PARAMETER":
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return fail(fmt.Errorf("expected 4 values, got %d", len(parts)))
+		}
+		var values [4]uint8
+		for i, part := range parts {
+			v, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return fail(err)
+			}
+			values[i] = uint8(v)
+		}
+		config.Parameter = &Parameters{
+			SpreadingFactor:    values[0],
+			Bandwidth:          values[1],
+			CodingRate:         values[2],
+			ProgrammedPreamble: values[3],
+		}
+	case "MODE":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fail(err)
+		}
+		mode := uint8(v)
+		config.Mode = &mode
+	case "IPR":
+		baudRate, err := strconv.Atoi(value)
+		if err != nil {
+			return fail(err)
+		}
+		config.UartBaudRate = &baudRate
+	case "CPIN":
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return fail(err)
+		}
+		if len(b) != 16 {
+			return fail(fmt.Errorf("expected 16 bytes, got %d", len(b)))
+		}
+		var key [16]byte
+		copy(key[:], b)
+		config.EncryptionKey = &key
+	case "CRFOP":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fail(err)
+		}
+		power := uint8(v)
+		config.RFOutputPower = &power
+	default:
+		return fmt.Errorf("unknown configuration field %s", field)
+	}
+	return nil
+}
+
+// GetConfig reads the module's current configuration, every field is filled in
+func (Lora *lora) GetConfig() (Configuration, *ErrorEvent) {
+	return Lora.GetConfigContext(context.Background())
+}
+
+// GetConfigContext reads the module's current configuration, stopping at the first field when ctx ends,
+// an answer that cannot be parsed is reported as a *ConfigParseError
+func (Lora *lora) GetConfigContext(ctx context.Context) (Configuration, *ErrorEvent) {
+	var config Configuration
+	for _, field := range configFields {
+		if err := Lora.readConfigField(ctx, &config, field); err != nil {
+			return config, err
+		}
+	}
+	if config.Parameter != nil {
+		Lora.setParameters(*config.Parameter)
+	}
+	return config, nil
+}
+
+// readConfigField queries one field into config
+func (Lora *lora) readConfigField(ctx context.Context, config *Configuration, field string) *ErrorEvent {
+	label := configFieldLabels[field]
+	resp := Lora.execute(ctx, Command{Text: "AT+" + field + "?"})
+	if resp.Error != nil {
+		if resp.Error.Err != nil {
+			return &ErrorEvent{Code: resp.Error.Code, Err: fmt.Errorf("failed to read %s: %w", label, resp.Error.Err)}
+		}
+		return &ErrorEvent{Code: resp.Error.Code, Err: fmt.Errorf("failed to read %s", label)}
+	}
+	response := strings.TrimSuffix(strings.TrimSuffix(resp.Response, "\n"), "\r")
+	if err := parseConfigAnswer(config, field, response); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("failed to read %s: %w", label, err)}
+	}
+	return nil
+}
+
+// configField returns a configuration holding only the named field of config, ok is false when it is nil
+func configField(config Configuration, field string) (Configuration, bool) {
+	var single Configuration
+	switch field {
+	case "ADDRESS":
+		single.Address = config.Address
+	case "NETWORKID":
+		single.NetworkID = config.NetworkID
+	case "BAND":
+		single.Band = config.Band
+	case "PARAMETER":
+		single.Parameter = config.Parameter
+	case "MODE":
+		single.Mode = config.Mode
+	case "IPR":
+		single.UartBaudRate = config.UartBaudRate
+	case "CPIN":
+		single.EncryptionKey = config.EncryptionKey
+	case "CRFOP":
+		single.RFOutputPower = config.RFOutputPower
+	}
+	cmds := configCommands(single)
+	return single, len(cmds) == 1
+}
+
+// configValue returns the named field of config as it is written in the AT command, empty when it is nil
+func configValue(config Configuration, field string) string {
+	single, ok := configField(config, field)
+	if !ok {
+		return ""
+	}
+	_, value, _ := strings.Cut(configCommands(single)[0], "=")
+	return value
+}
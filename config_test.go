@@ -0,0 +1,93 @@
+package krylr896
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestGetConfig reads back a configuration applied to an emulated module
+func TestGetConfig(t *testing.T) {
+	address := uint16(7)
+	networkID := uint8(3)
+	band := BandINDIA
+	mode := MODE_TRX
+	rfPower := uint8(12)
+	key := [16]byte{0xfa, 0xbc, 0x00, 0x02}
+	params := Parameters{SpreadingFactor: 10, Bandwidth: Bandwidth250KHz, CodingRate: 2, ProgrammedPreamble: 5}
+
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{
+		Address:       &address,
+		NetworkID:     &networkID,
+		Band:          &band,
+		Parameter:     &params,
+		Mode:          &mode,
+		EncryptionKey: &key,
+		RFOutputPower: &rfPower,
+	}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	config, err := lora.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err.Err)
+	}
+	if config.Address == nil || config.NetworkID == nil || config.Band == nil || config.Parameter == nil ||
+		config.Mode == nil || config.UartBaudRate == nil || config.EncryptionKey == nil || config.RFOutputPower == nil {
+		t.Fatalf("configuration not fully populated: %+v", config)
+	}
+	if *config.Address != address || *config.NetworkID != networkID || *config.Band != band ||
+		*config.Parameter != params || *config.Mode != mode || *config.UartBaudRate != UartBaudRate_115200 ||
+		*config.EncryptionKey != key || *config.RFOutputPower != rfPower {
+		t.Fatalf("unexpected configuration: %+v", config)
+	}
+}
+
+// TestParseConfigAnswer checks that malformed answers are reported as a *ConfigParseError
+func TestParseConfigAnswer(t *testing.T) {
+	tests := []struct {
+		field    string
+		response string
+		valid    bool
+	}{
+		{"ADDRESS", "+ADDRESS=65535", true},
+		{"ADDRESS", "+ADDRESS=65536", false},
+		{"ADDRESS", "+NETWORKID=3", false},
+		{"PARAMETER", "+PARAMETER=12,7,1,4", true},
+		{"PARAMETER", "+PARAMETER=12,7,1", false},
+		{"PARAMETER", "+PARAMETER=12,7,x,4", false},
+		{"CPIN", "+CPIN=FABC0002EEDCAA90FABC0002EEDCAA90", true},
+		{"CPIN", "+CPIN=FABC0002", false},
+		{"CPIN", "+CPIN=No Password!", false},
+		{"IPR", "+IPR=115200", true},
+		{"CRFOP", "+CRFOP=", false},
+	}
+	for _, test := range tests {
+		var config Configuration
+		err := parseConfigAnswer(&config, test.field, test.response)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", test.response, err)
+			}
+			continue
+		}
+		var parseErr *ConfigParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: expected a *ConfigParseError, got %v", test.response, err)
+			continue
+		}
+		if parseErr.Field != test.field || parseErr.Response != test.response {
+			t.Errorf("%q: unexpected error fields %+v", test.response, parseErr)
+		}
+	}
+
+	var config Configuration
+	if err := parseConfigAnswer(&config, "ADDRESS", "+ADDRESS=70000"); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("expected the range error to be wrapped, got %v", err)
+	}
+}
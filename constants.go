@@ -40,12 +40,16 @@ const (
 	UartBaudRate_1200   int = 1200
 	UartBaudRate_4800   int = 4800
 	UartBaudRate_9600   int = 9600
-	UartBaudRate_28800  int = 19200
+	UartBaudRate_19200  int = 19200
+	UartBaudRate_28800  int = 28800 // held 19200 in earlier releases, use UartBaudRate_19200 for that rate
 	UartBaudRate_38400  int = 38400
 	UartBaudRate_57600  int = 57600
 	UartBaudRate_115200 int = 115200 // default
 )
 
+// UartBaudRates lists the rates AT+IPR accepts, fastest first
+var UartBaudRates = []int{115200, 57600, 38400, 28800, 19200, 9600, 4800, 1200, 300}
+
 // result code constants
 const (
 	OK       = 0  // OK
@@ -0,0 +1,74 @@
+package krylr896
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestSendMessageContext cancels a send in flight and one still queued, then checks that responses
+// stay matched to their commands
+func TestSendMessageContext(t *testing.T) {
+	module := emulator.New()
+	faults := NewFaultTransport(module.Attach(), 1, FaultRule{Kind: FaultDelayLine, Match: "+OK", Nth: 1, Delay: 300 * time.Millisecond})
+	lora, err := CreateConnectionTransport(faults, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	// in flight, its +OK is delayed past the deadline
+	inFlight, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	sendErr := lora.SendMessageContext(inFlight, 2, []byte("first"))
+	if sendErr == nil || !errors.Is(sendErr.Err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %+v", sendErr)
+	}
+	if time.Since(start) > 250*time.Millisecond {
+		t.Fatal("cancelled send did not return promptly")
+	}
+
+	// queued behind the first, cancelled before run() gets to it
+	queued, cancelQueued := context.WithCancel(context.Background())
+	done := make(chan *ErrorEvent)
+	go func() { done <- lora.SendMessageContext(queued, 2, []byte("withdrawn")) }()
+	time.Sleep(20 * time.Millisecond)
+	cancelQueued()
+	if sendErr := <-done; sendErr == nil || !errors.Is(sendErr.Err, context.Canceled) {
+		t.Fatalf("expected a cancelled error, got %+v", sendErr)
+	}
+
+	// the delayed +OK belongs to the first send, this one must get its own answer
+	if sendErr := lora.SendMessage(2, []byte("third")); sendErr != nil {
+		t.Fatalf("send after cancellation failed: %v", sendErr.Err)
+	}
+
+	sent := module.Sent()
+	if len(sent) != 2 || string(sent[0].Data) != "first" || string(sent[1].Data) != "third" {
+		t.Fatalf("unexpected frames %+v", sent)
+	}
+}
+
+// TestSendCommandContext checks the raw command method
+func TestSendCommandContext(t *testing.T) {
+	lora, err := CreateConnectionTransport(emulator.New().Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	response, errEvent := lora.SendCommand("AT+ADDRESS?")
+	if errEvent != nil || response != "+ADDRESS=0" {
+		t.Fatalf("got %q, %+v", response, errEvent)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, errEvent := lora.SendCommandContext(ctx, "AT"); errEvent == nil || !errors.Is(errEvent.Err, context.Canceled) {
+		t.Fatalf("expected a cancelled error, got %+v", errEvent)
+	}
+}
@@ -0,0 +1,170 @@
+package krylr896
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BandRange is a span of centre frequencies in Hz, both ends included
+type BandRange struct {
+	Min uint32
+	Max uint32
+}
+
+// Capabilities are the limits of a module family
+type Capabilities struct {
+	Family           string      // model prefix the family's firmware versions start with, empty if unknown
+	Bands            []BandRange // frequencies the radio tunes to
+	MaxRFOutputPower uint8       // highest CRFOP value in dBm
+	Modes            []uint8     // MODE values the firmware accepts
+}
+
+// clone returns a copy of caps that shares no slices with it
+func (caps Capabilities) clone() Capabilities {
+	caps.Bands = slices.Clone(caps.Bands)
+	caps.Modes = slices.Clone(caps.Modes)
+	return caps
+}
+
+// models is the capability table, keyed by the model prefix of the firmware version. The built-in
+// families share their power and mode limits and differ only in band, RegisterModel can add modules
+// whose other limits differ
+var (
+	modelsMu sync.RWMutex
+	models   = map[string]Capabilities{
+		"RYLR89": { // RYLR896 and RYLR890, 868/915 MHz
+			Family:           "RYLR89",
+			Bands:            []BandRange{{Min: 862000000, Max: 1020000000}},
+			MaxRFOutputPower: 15,
+			Modes:            []uint8{MODE_TRX, MODE_SLEEP},
+		},
+		"RYLR40": { // RYLR406 and RYLR403, 433/470 MHz
+			Family:           "RYLR40",
+			Bands:            []BandRange{{Min: 410000000, Max: 525000000}},
+			MaxRFOutputPower: 15,
+			Modes:            []uint8{MODE_TRX, MODE_SLEEP},
+		},
+	}
+)
+
+// genericCapabilities are assumed when the model is not known, every built-in family's limits combined
+var genericCapabilities = Capabilities{
+	Bands:            []BandRange{{Min: 410000000, Max: 525000000}, {Min: 862000000, Max: 1020000000}},
+	MaxRFOutputPower: 15,
+	Modes:            []uint8{MODE_TRX, MODE_SLEEP},
+}
+
+// GenericCapabilities returns the limits assumed when the model is not known, every built-in family's
+// limits combined
+func GenericCapabilities() Capabilities {
+	return genericCapabilities.clone()
+}
+
+// RegisterModel adds or replaces the capabilities of the modules whose firmware version starts with
+// prefix, it is safe to call while connections are open and applies from their next DeviceInfo
+func RegisterModel(prefix string, caps Capabilities) {
+	if caps.Family == "" {
+		caps.Family = prefix
+	}
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[prefix] = caps.clone()
+}
+
+// CapabilitiesFor looks up a model or firmware version in the capability table, the longest matching
+// prefix wins, ok is false and GenericCapabilities are returned when nothing matches. The result is a
+// copy, changing it does not change the table
+func CapabilitiesFor(model string) (caps Capabilities, ok bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	best := ""
+	for prefix := range models {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return GenericCapabilities(), false
+	}
+	return models[best].clone(), true
+}
+
+// DeviceInfo identifies a module
+type DeviceInfo struct {
+	Version      string       // firmware version from AT+VER?
+	UID          string       // unique ID from AT+UID?
+	Model        string       // model from the firmware version, e.g. "RYLR89C" for "RYLR89C_V1.2.7"
+	Capabilities Capabilities // limits of the model, GenericCapabilities if it is not registered
+}
+
+// modelFromVersion returns the model part of a firmware version, everything before the first "_"
+func modelFromVersion(version string) string {
+	model, _, _ := strings.Cut(version, "_")
+	return model
+}
+
+// DeviceInfo queries the module's firmware version and unique ID and looks up its capabilities, which
+// configuration is validated against from then on
+func (Lora *lora) DeviceInfo() (DeviceInfo, *ErrorEvent) {
+	return Lora.DeviceInfoContext(context.Background())
+}
+
+// DeviceInfoContext is DeviceInfo, giving up when ctx ends
+func (Lora *lora) DeviceInfoContext(ctx context.Context) (DeviceInfo, *ErrorEvent) {
+	var info DeviceInfo
+
+	version, err := Lora.queryDeviceValue(ctx, "VER")
+	if err != nil {
+		if err.Err != nil {
+			return info, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to read firmware version: %w", err.Err)}
+		}
+		return info, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to read firmware version")}
+	}
+	uid, err := Lora.queryDeviceValue(ctx, "UID")
+	if err != nil {
+		if err.Err != nil {
+			return info, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to read unique ID: %w", err.Err)}
+		}
+		return info, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to read unique ID")}
+	}
+
+	info.Version = version
+	info.UID = uid
+	info.Model = modelFromVersion(version)
+	info.Capabilities, _ = CapabilitiesFor(info.Model)
+
+	caps := info.Capabilities.clone()
+	Lora.mu.Lock()
+	Lora.caps = &caps
+	Lora.mu.Unlock()
+	return info, nil
+}
+
+// queryDeviceValue sends AT+<name>? and returns the value after "+<name>="
+func (Lora *lora) queryDeviceValue(ctx context.Context, name string) (string, *ErrorEvent) {
+	resp := Lora.execute(ctx, Command{Text: "AT+" + name + "?"})
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+	line := strings.TrimRight(resp.Response, "\r\n")
+	value, found := strings.CutPrefix(line, "+"+name+"=")
+	if !found {
+		return "", &ErrorEvent{Code: nil, Err: fmt.Errorf("unexpected answer %q", line)}
+	}
+	return value, nil
+}
+
+// Capabilities returns the limits of the connected module, GenericCapabilities until DeviceInfo has
+// identified it, either when called or when connecting with ConnectionOptions.IdentifyModel
+func (Lora *lora) Capabilities() Capabilities {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	if Lora.caps == nil {
+		return GenericCapabilities()
+	}
+	return Lora.caps.clone()
+}
@@ -0,0 +1,140 @@
+package krylr896
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestDeviceInfo checks that the module is identified on request, and when connecting only if asked to
+func TestDeviceInfo(t *testing.T) {
+	state := emulator.DefaultState()
+	state.UID = "0123456789ABCDEF01234567"
+	lora, err := CreateConnectionTransport(emulator.NewWithState(state).Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	if caps := lora.Capabilities(); caps.Family != "" {
+		t.Fatalf("model identified without IdentifyModel: %+v", caps)
+	}
+	info, err := lora.DeviceInfo()
+	if err != nil {
+		t.Fatalf("DeviceInfo failed: %v", err.Err)
+	}
+	if info.Version != state.Version || info.UID != state.UID || info.Model != "RYLR89C" || info.Capabilities.Family != "RYLR89" {
+		t.Fatalf("unexpected device info %+v", info)
+	}
+	if caps := lora.Capabilities(); caps.Family != "RYLR89" {
+		t.Fatalf("capabilities not updated by DeviceInfo: %+v", caps)
+	}
+
+	identified, err := CreateConnectionTransportWithOptions(emulator.New().Attach(), 0, Configuration{}, 10, ConnectionOptions{IdentifyModel: true})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer identified.CloseConnection()
+	if caps := identified.Capabilities(); caps.Family != "RYLR89" {
+		t.Fatalf("model not identified when connecting: %+v", caps)
+	}
+}
+
+// TestIdentifyModelFails checks that connecting fails when the module does not answer AT+VER?
+func TestIdentifyModelFails(t *testing.T) {
+	faults := NewFaultTransport(emulator.New().Attach(), 1, FaultRule{Kind: FaultDropLine, Match: "+VER="})
+	timing := &CommandTiming{Timeouts: map[string]time.Duration{"VER": 100 * time.Millisecond}}
+	lora, err := CreateConnectionTransportWithOptions(faults, 0, Configuration{}, 10, ConnectionOptions{IdentifyModel: true, Timing: timing})
+	if err == nil {
+		lora.CloseConnection()
+		t.Fatal("connected without identifying the module")
+	}
+	if !strings.Contains(err.Err.Error(), "failed to identify module") {
+		t.Fatalf("unexpected error %v", err.Err)
+	}
+}
+
+// TestCapabilitiesValidation checks that configuration is validated against the identified model
+func TestCapabilitiesValidation(t *testing.T) {
+	state := emulator.DefaultState()
+	state.Version = "RYLR40C_V1.0.1"
+	state.Band = BandEUROPE2
+	lora, err := CreateConnectionTransportWithOptions(emulator.NewWithState(state).Attach(), 0, Configuration{}, 10, ConnectionOptions{IdentifyModel: true})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	band := BandUSA
+	err = lora.SetConfig(Configuration{Band: &band})
+	var fieldErr *FieldError
+	if err == nil || !errors.As(err.Err, &fieldErr) || fieldErr.Field != "BAND" {
+		t.Fatalf("expected a BAND validation error for a 433 MHz module, got %+v", err)
+	}
+	band = BandCHINA
+	if err := lora.SetConfig(Configuration{Band: &band}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err.Err)
+	}
+
+	// Validate on its own checks against every family's limits combined
+	if err := (Configuration{Band: &band}).Validate(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if caps, ok := CapabilitiesFor("RYLR998_V1"); ok || caps.Family != "" {
+		t.Fatalf("unknown model matched %+v", caps)
+	}
+}
+
+// TestRegisterModel checks that a registered model is found by the longest prefix, also while other
+// goroutines look models up
+func TestRegisterModel(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				CapabilitiesFor("RYLR896_V1")
+			}
+		}()
+	}
+	RegisterModel("RYLR896T", Capabilities{
+		Bands:            []BandRange{{Min: 902000000, Max: 928000000}},
+		MaxRFOutputPower: 14,
+		Modes:            []uint8{MODE_TRX},
+	})
+	wg.Wait()
+
+	caps, ok := CapabilitiesFor("RYLR896T_V2.0")
+	if !ok || caps.Family != "RYLR896T" || caps.MaxRFOutputPower != 14 {
+		t.Fatalf("registered model not found: %+v", caps)
+	}
+	if caps, _ := CapabilitiesFor("RYLR896_V1"); caps.Family != "RYLR89" {
+		t.Fatalf("built-in model shadowed: %+v", caps)
+	}
+
+	power := uint8(15)
+	if err := (Configuration{RFOutputPower: &power}).ValidateFor(caps); err == nil {
+		t.Fatal("expected CRFOP 15 to be rejected for the registered model")
+	}
+}
+
+// TestCapabilitiesCopied checks that changing looked up capabilities does not change the table
+func TestCapabilitiesCopied(t *testing.T) {
+	caps, _ := CapabilitiesFor("RYLR896_V1")
+	caps.Bands[0].Max = 0
+	caps.Modes[0] = 9
+	if again, _ := CapabilitiesFor("RYLR896_V1"); again.Bands[0].Max != 1020000000 || again.Modes[0] != MODE_TRX {
+		t.Fatalf("table changed through a lookup: %+v", again)
+	}
+
+	generic := GenericCapabilities()
+	generic.Bands[0].Min = 0
+	if again := GenericCapabilities(); again.Bands[0].Min != 410000000 {
+		t.Fatalf("generic capabilities changed: %+v", again)
+	}
+}
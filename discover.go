@@ -0,0 +1,113 @@
+package krylr896
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.bug.st/serial"
+)
+
+// DiscoveredDevice describes a module found on a serial port
+type DiscoveredDevice struct {
+	Port     string // device path
+	BaudRate int    // rate the module answered at
+	Version  string // firmware version from AT+VER?
+	UID      string // unique ID from AT+UID?
+}
+
+// String formats the device for logs
+func (d DiscoveredDevice) String() string {
+	return d.Port + "@" + strconv.Itoa(d.BaudRate) + " " + d.Version + " " + d.UID
+}
+
+// identify probes an open transport for a module and reads its identity, the transport is closed
+// before it returns so the reader can be stopped
+func identify(t Transport, baudRates []int) (DiscoveredDevice, error) {
+	var device DiscoveredDevice
+	reader := startPortReader(t, func(string, ...interface{}) {})
+	defer reader.stop()
+	defer t.Close()
+
+	baudRate, err := probeBaudRate(t, reader, baudRates)
+	if err != nil {
+		return device, err
+	}
+	device.BaudRate = baudRate
+
+	if device.Version, err = queryValue(t, reader, "AT+VER?"); err != nil {
+		return device, err
+	}
+	if device.UID, err = queryValue(t, reader, "AT+UID?"); err != nil {
+		return device, err
+	}
+	return device, nil
+}
+
+// Discover enumerates the serial ports and probes each one for a module, trying baudRates in order,
+// UartBaudRates is used when baudRates is empty, ports that are busy or silent are skipped
+func Discover(baudRates []int) ([]DiscoveredDevice, error) {
+	if len(baudRates) == 0 {
+		baudRates = UartBaudRates
+	}
+
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []DiscoveredDevice
+	for _, port := range ports {
+		transport, err := openSerialTransport(port, baudRates[0])
+		if err != nil {
+			continue
+		}
+		device, err := identify(transport, baudRates)
+		if err != nil {
+			continue
+		}
+		device.Port = port
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// FindByUID discovers the attached modules and returns the one with the given unique ID
+func FindByUID(uid string, baudRates []int) (DiscoveredDevice, error) {
+	devices, err := Discover(baudRates)
+	if err != nil {
+		return DiscoveredDevice{}, err
+	}
+	for _, device := range devices {
+		if device.UID == uid {
+			return device, nil
+		}
+	}
+	return DiscoveredDevice{}, fmt.Errorf("no module with UID %s found", uid)
+}
+
+// CreateConnectionByUID opens the module with the given unique ID on whichever port and at whichever
+// baud rate it is found
+func CreateConnectionByUID(uid string, config Configuration, buffLen int) (Lora *lora, errEvent *ErrorEvent) {
+	return CreateConnectionByUIDWithOptions(uid, config, buffLen, ConnectionOptions{})
+}
+
+// CreateConnectionByUIDWithOptions finds the module with the given unique ID and connects to it with
+// optional behaviour, a reconnect looks the module up again so it may come back on another port
+func CreateConnectionByUIDWithOptions(uid string, config Configuration, buffLen int, opts ConnectionOptions) (Lora *lora, errEvent *ErrorEvent) {
+	device, err := FindByUID(uid, nil)
+	if err != nil {
+		return nil, &ErrorEvent{Code: nil, Err: err}
+	}
+	if opts.Reconnect != nil && opts.Reconnect.Dial == nil {
+		reconnect := *opts.Reconnect
+		reconnect.Dial = func(baudRate int) (Transport, error) {
+			device, err := FindByUID(uid, []int{baudRate})
+			if err != nil {
+				return nil, err
+			}
+			return openSerialTransport(device.Port, device.BaudRate)
+		}
+		opts.Reconnect = &reconnect
+	}
+	return CreateConnectionWithOptions(device.Port, device.BaudRate, config, buffLen, opts)
+}
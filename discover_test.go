@@ -0,0 +1,95 @@
+package krylr896
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestIdentify probes an emulated module that was left at a non-default baud rate
+func TestIdentify(t *testing.T) {
+	state := emulator.DefaultState()
+	state.BaudRate = UartBaudRate_9600
+	state.UID = "104737333437353600170029"
+	module := emulator.NewWithState(state)
+
+	conn := module.Attach()
+	conn.SetBaudRate(UartBaudRate_115200)
+
+	device, err := identify(conn, UartBaudRates)
+	if err != nil {
+		t.Fatalf("identify: %v", err)
+	}
+	if device.BaudRate != UartBaudRate_9600 || device.UID != state.UID || device.Version != state.Version {
+		t.Fatalf("unexpected device %+v", device)
+	}
+}
+
+// TestIdentify28800 checks that a module is found at 28800 and 19200, which are easily mixed up
+func TestIdentify28800(t *testing.T) {
+	for _, baudRate := range []int{28800, 19200} {
+		state := emulator.DefaultState()
+		state.BaudRate = baudRate
+		conn := emulator.NewWithState(state).Attach()
+		conn.SetBaudRate(UartBaudRate_115200)
+
+		device, err := identify(conn, UartBaudRates)
+		if err != nil {
+			t.Fatalf("identify at %d: %v", baudRate, err)
+		}
+		if device.BaudRate != baudRate {
+			t.Fatalf("module at %d found at %d", baudRate, device.BaudRate)
+		}
+	}
+}
+
+// chattyPort is a serial device that keeps sending NMEA sentences and never answers AT
+type chattyPort struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Read returns a sentence every millisecond until the port is closed
+func (p *chattyPort) Read(b []byte) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, errors.New("port closed")
+	case <-time.After(time.Millisecond):
+		return copy(b, "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47\r\n"), nil
+	}
+}
+
+// Write discards commands
+func (p *chattyPort) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Close ends pending and later reads, slowly like some USB adapters, so sentences keep arriving
+// after the probe has given up
+func (p *chattyPort) Close() error {
+	time.Sleep(20 * time.Millisecond)
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
+
+// TestIdentifyStopsReader checks that probing a port that is not a module leaves no goroutines behind
+func TestIdentifyStopsReader(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 3; i++ {
+		if _, err := identify(&chattyPort{closed: make(chan struct{})}, []int{UartBaudRate_115200}); err == nil {
+			t.Fatal("expected no module to be found")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left running, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
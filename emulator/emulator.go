@@ -0,0 +1,579 @@
+// Package emulator implements an in-process RYLR896 that answers the module's AT command set,
+// the host side of the link is a Conn that can be handed to krylr896.CreateConnectionTransport
+package emulator
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// result codes returned by the firmware, these mirror the constants in the krylr896 package
+const (
+	errNoEnter = 1  // missing "\r\n" after command
+	errNoAT    = 2  // head of command is not AT
+	errNoEq    = 3  // missing "=" in AT command
+	errUnkCmd  = 4  // unknown command or value out of range
+	errTxOR    = 13 // transmit over run(over 240 bytes)
+)
+
+// maxPayload is the largest AT+SEND payload the module accepts
+const maxPayload = 240
+
+// valid IPR rates
+var baudRates = []int{300, 1200, 4800, 9600, 19200, 28800, 38400, 57600, 115200}
+
+// Parameters mirrors the AT+PARAMETER fields
+type Parameters struct {
+	SpreadingFactor    uint8 // SF, 7-12
+	Bandwidth          uint8 // BW, 0-9
+	CodingRate         uint8 // CR, 1-4
+	ProgrammedPreamble uint8 // PP, 4-7
+}
+
+// State is the persisted configuration and identity of an emulated module
+type State struct {
+	Address       uint16     // ADDRESS
+	NetworkID     uint8      // NETWORKID
+	Band          uint32     // BAND(Hz)
+	Parameters    Parameters // PARAMETER
+	Mode          uint8      // MODE
+	BaudRate      int        // IPR
+	Password      [16]byte   // CPIN, all zero when unset
+	RFOutputPower uint8      // CRFOP(dBm)
+	Version       string     // reported by AT+VER?
+	UID           string     // reported by AT+UID?
+}
+
+// DefaultState returns the factory settings of a RYLR896
+func DefaultState() State {
+	return State{
+		Address:   0,
+		NetworkID: 0,
+		Band:      915000000,
+		Parameters: Parameters{
+			SpreadingFactor:    12,
+			Bandwidth:          7,
+			CodingRate:         1,
+			ProgrammedPreamble: 4,
+		},
+		Mode:          0,
+		BaudRate:      115200,
+		RFOutputPower: 15,
+		Version:       "RYLR89C_V1.2.7",
+		UID:           "000000000000000000000000",
+	}
+}
+
+// Frame is a transmission made with AT+SEND, along with the radio settings it was sent with
+type Frame struct {
+	Source        uint16
+	Destination   uint16
+	Data          []byte
+	NetworkID     uint8
+	Band          uint32
+	Parameters    Parameters
+	Password      [16]byte
+	RFOutputPower uint8
+}
+
+// Module is an emulated RYLR896, create one with New and attach a host with Attach
+type Module struct {
+	mu         sync.Mutex
+	state      State
+	conn       *Conn   // currently attached host, nil if none
+	in         []byte  // partial command line from the host
+	sent       []Frame // every frame transmitted so far
+	onTransmit func(Frame)
+	hung       bool // ignoring the host until the reset pin is pulsed
+}
+
+// New creates a module with factory settings
+func New() *Module {
+	return NewWithState(DefaultState())
+}
+
+// NewWithState creates a module with the given persisted state
+func NewWithState(state State) *Module {
+	return &Module{state: state}
+}
+
+// State returns a snapshot of the module's current configuration
+func (m *Module) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// SetTransmitHandler registers a callback invoked for every frame sent with AT+SEND
+func (m *Module) SetTransmitHandler(handler func(Frame)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onTransmit = handler
+}
+
+// Sent returns every frame the module has transmitted
+func (m *Module) Sent() []Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Frame(nil), m.sent...)
+}
+
+// Attach connects a new host to the module's UART, any previously attached host is disconnected
+func (m *Module) Attach() *Conn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn != nil {
+		m.conn.shutdown(io.EOF)
+	}
+	c := &Conn{module: m, baudRate: m.state.BaudRate, rts: true}
+	c.cond = sync.NewCond(&c.mu)
+	m.conn = c
+	m.in = nil
+	return c
+}
+
+// Hang makes the module stop answering, as wedged firmware does, until its reset pin is pulsed
+func (m *Module) Hang() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hung = true
+}
+
+// Inject makes the module report a received frame, as if it had been heard over the air
+func (m *Module) Inject(source uint16, data []byte, rssi int, snr int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emit(fmt.Sprintf("+RCV=%d,%d,%s,%d,%d", source, len(data), data, rssi, snr))
+}
+
+// InjectRaw writes arbitrary bytes to the host, no line ending is added
+func (m *Module) InjectRaw(data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil && m.conn.baudRate == m.state.BaudRate {
+		m.conn.push(data)
+	}
+}
+
+// Deliver hands a frame heard over the air to the module, it is reported to the host only if it is
+// addressed to this module (or broadcast to address 0) and the module is not asleep
+func (m *Module) Deliver(frame Frame, rssi int, snr int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state.Mode != 0 {
+		return false
+	}
+	if frame.Destination != 0 && frame.Destination != m.state.Address {
+		return false
+	}
+	m.emit(fmt.Sprintf("+RCV=%d,%d,%s,%d,%d", frame.Source, len(frame.Data), frame.Data, rssi, snr))
+	return true
+}
+
+// emit writes a line to the attached host, output is lost when the baud rates differ, caller holds m.mu
+func (m *Module) emit(line string) {
+	if m.conn == nil || m.conn.baudRate != m.state.BaudRate {
+		return
+	}
+	m.conn.push([]byte(line + "\r\n"))
+}
+
+// receive handles bytes written by the host
+func (m *Module) receive(c *Conn, p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// input from a detached host, a host held in reset, at the wrong baud rate or to a hung module is lost
+	if c != m.conn || !c.rts || c.baudRate != m.state.BaudRate || m.hung {
+		return
+	}
+
+	m.in = append(m.in, p...)
+	for {
+		idx := strings.IndexByte(string(m.in), '\n')
+		if idx == -1 {
+			return
+		}
+		line := string(m.in[:idx])
+		m.in = m.in[idx+1:]
+
+		if !strings.HasSuffix(line, "\r") {
+			m.emitError(errNoEnter)
+			continue
+		}
+		m.execute(strings.TrimSuffix(line, "\r"))
+	}
+}
+
+// emitError writes a +ERR=<code> line, caller holds m.mu
+func (m *Module) emitError(code int) {
+	m.emit(fmt.Sprintf("+ERR=%d", code))
+}
+
+// execute runs one command line without its line ending, caller holds m.mu
+func (m *Module) execute(line string) {
+	if !strings.HasPrefix(line, "AT") {
+		m.emitError(errNoAT)
+		return
+	}
+	if line == "AT" {
+		m.emit("+OK")
+		return
+	}
+
+	rest, found := strings.CutPrefix(line, "AT+")
+	if !found {
+		m.emitError(errUnkCmd)
+		return
+	}
+
+	// query form, AT+NAME?
+	if name, found := strings.CutSuffix(rest, "?"); found {
+		m.query(name)
+		return
+	}
+
+	name, value, hasValue := strings.Cut(rest, "=")
+	switch name {
+	case "RESET":
+		if hasValue {
+			m.emitError(errUnkCmd)
+			return
+		}
+		m.emit("+RESET")
+		m.emit("+READY")
+		return
+	case "FACTORY":
+		if hasValue {
+			m.emitError(errUnkCmd)
+			return
+		}
+		version, uid := m.state.Version, m.state.UID
+		m.state = DefaultState()
+		m.state.Version, m.state.UID = version, uid
+		m.emit("+FACTORY")
+		return
+	}
+
+	if !hasValue {
+		if isSettable(name) {
+			m.emitError(errNoEq)
+		} else {
+			m.emitError(errUnkCmd)
+		}
+		return
+	}
+
+	if code := m.set(name, value); code != 0 {
+		m.emitError(code)
+	}
+}
+
+// isSettable reports whether name is a command that takes a value
+func isSettable(name string) bool {
+	switch name {
+	case "ADDRESS", "NETWORKID", "BAND", "PARAMETER", "MODE", "IPR", "CPIN", "CRFOP", "SEND":
+		return true
+	}
+	return false
+}
+
+// query answers AT+NAME?, caller holds m.mu
+func (m *Module) query(name string) {
+	switch name {
+	case "ADDRESS":
+		m.emit(fmt.Sprintf("+ADDRESS=%d", m.state.Address))
+	case "NETWORKID":
+		m.emit(fmt.Sprintf("+NETWORKID=%d", m.state.NetworkID))
+	case "BAND":
+		m.emit(fmt.Sprintf("+BAND=%d", m.state.Band))
+	case "PARAMETER":
+		p := m.state.Parameters
+		m.emit(fmt.Sprintf("+PARAMETER=%d,%d,%d,%d", p.SpreadingFactor, p.Bandwidth, p.CodingRate, p.ProgrammedPreamble))
+	case "MODE":
+		m.emit(fmt.Sprintf("+MODE=%d", m.state.Mode))
+	case "IPR":
+		m.emit(fmt.Sprintf("+IPR=%d", m.state.BaudRate))
+	case "CPIN":
+		m.emit("+CPIN=" + strings.ToUpper(hex.EncodeToString(m.state.Password[:])))
+	case "CRFOP":
+		m.emit(fmt.Sprintf("+CRFOP=%d", m.state.RFOutputPower))
+	case "VER":
+		m.emit("+VER=" + m.state.Version)
+	case "UID":
+		m.emit("+UID=" + m.state.UID)
+	default:
+		m.emitError(errUnkCmd)
+	}
+}
+
+// set applies AT+NAME=value and writes +OK on success, it returns a result code on failure, caller holds m.mu
+func (m *Module) set(name string, value string) int {
+	switch name {
+	case "ADDRESS":
+		v, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return errUnkCmd
+		}
+		m.state.Address = uint16(v)
+
+	case "NETWORKID":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || v > 16 {
+			return errUnkCmd
+		}
+		m.state.NetworkID = uint8(v)
+
+	case "BAND":
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || v < 410000000 || v > 1020000000 {
+			return errUnkCmd
+		}
+		m.state.Band = uint32(v)
+
+	case "PARAMETER":
+		fields := strings.Split(value, ",")
+		if len(fields) != 4 {
+			return errUnkCmd
+		}
+		var vals [4]uint8
+		for i, field := range fields {
+			v, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return errUnkCmd
+			}
+			vals[i] = uint8(v)
+		}
+		p := Parameters{SpreadingFactor: vals[0], Bandwidth: vals[1], CodingRate: vals[2], ProgrammedPreamble: vals[3]}
+		if p.SpreadingFactor < 7 || p.SpreadingFactor > 12 || p.Bandwidth > 9 ||
+			p.CodingRate < 1 || p.CodingRate > 4 || p.ProgrammedPreamble < 4 || p.ProgrammedPreamble > 7 {
+			return errUnkCmd
+		}
+		m.state.Parameters = p
+
+	case "MODE":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || v > 1 {
+			return errUnkCmd
+		}
+		m.state.Mode = uint8(v)
+
+	case "IPR":
+		v, err := strconv.Atoi(value)
+		if err != nil || !validBaudRate(v) {
+			return errUnkCmd
+		}
+		// the +OK goes out at the old rate, then the UART switches
+		m.emit("+OK")
+		m.state.BaudRate = v
+		return 0
+
+	case "CPIN":
+		key, err := hex.DecodeString(value)
+		if err != nil || len(key) != len(m.state.Password) {
+			return errUnkCmd
+		}
+		copy(m.state.Password[:], key)
+
+	case "CRFOP":
+		v, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || v > 15 {
+			return errUnkCmd
+		}
+		m.state.RFOutputPower = uint8(v)
+
+	case "SEND":
+		return m.send(value)
+
+	default:
+		return errUnkCmd
+	}
+
+	m.emit("+OK")
+	return 0
+}
+
+// send handles AT+SEND=<address>,<length>,<data>, caller holds m.mu
+func (m *Module) send(value string) int {
+	addrStr, rest, found := strings.Cut(value, ",")
+	if !found {
+		return errUnkCmd
+	}
+	lenStr, data, found := strings.Cut(rest, ",")
+	if !found {
+		return errUnkCmd
+	}
+
+	addr, err := strconv.ParseUint(addrStr, 10, 16)
+	if err != nil {
+		return errUnkCmd
+	}
+	length, err := strconv.Atoi(lenStr)
+	if err != nil || length < 0 {
+		return errUnkCmd
+	}
+	if length > maxPayload {
+		return errTxOR
+	}
+	if length != len(data) {
+		return errUnkCmd
+	}
+
+	frame := Frame{
+		Source:        m.state.Address,
+		Destination:   uint16(addr),
+		Data:          []byte(data),
+		NetworkID:     m.state.NetworkID,
+		Band:          m.state.Band,
+		Parameters:    m.state.Parameters,
+		Password:      m.state.Password,
+		RFOutputPower: m.state.RFOutputPower,
+	}
+	m.sent = append(m.sent, frame)
+	m.emit("+OK")
+
+	if m.onTransmit != nil {
+		handler := m.onTransmit
+		go handler(frame)
+	}
+	return 0
+}
+
+// validBaudRate reports whether rate is accepted by AT+IPR
+func validBaudRate(rate int) bool {
+	for _, r := range baudRates {
+		if r == rate {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnplugged is returned by a Conn after Unplug
+var ErrUnplugged = errors.New("emulated port unplugged")
+
+// Conn is the host end of a module's UART, it implements krylr896.Transport, BaudRateSetter and
+// ModemLineController, RTS is wired to the module's reset pin
+type Conn struct {
+	module   *Module
+	mu       sync.Mutex
+	cond     *sync.Cond
+	out      []byte // bytes waiting to be read by the host
+	err      error  // set once the connection is closed or unplugged
+	baudRate int    // host side UART rate, guarded by module.mu
+	rts      bool   // guarded by module.mu
+	dtr      bool   // guarded by module.mu
+}
+
+// push queues bytes for the host
+func (c *Conn) push(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.out = append(c.out, p...)
+	c.cond.Broadcast()
+}
+
+// shutdown ends the connection, pending and future reads return err
+func (c *Conn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+}
+
+// Read blocks until the module has output for the host
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.out) == 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	if len(c.out) == 0 {
+		return 0, c.err
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// Write sends bytes to the module
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	c.module.receive(c, p)
+	return len(p), nil
+}
+
+// Close detaches the host from the module
+func (c *Conn) Close() error {
+	c.module.detach(c)
+	c.shutdown(io.EOF)
+	return nil
+}
+
+// Unplug simulates the USB adapter disappearing, reads and writes fail with ErrUnplugged
+func (c *Conn) Unplug() {
+	c.module.detach(c)
+	c.shutdown(ErrUnplugged)
+}
+
+// SetBaudRate changes the host side UART rate, traffic is lost while it differs from the module's IPR
+func (c *Conn) SetBaudRate(baudRate int) error {
+	c.module.mu.Lock()
+	defer c.module.mu.Unlock()
+	c.baudRate = baudRate
+	return nil
+}
+
+// SetDTR sets the DTR line, it is not connected on the module
+func (c *Conn) SetDTR(dtr bool) error {
+	c.module.mu.Lock()
+	defer c.module.mu.Unlock()
+	c.dtr = dtr
+	return nil
+}
+
+// SetRTS drives the module's reset pin, the module is held in reset while RTS is low and reports
+// +READY when it is released
+func (c *Conn) SetRTS(rts bool) error {
+	m := c.module
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	released := rts && !c.rts
+	c.rts = rts
+	if released && c == m.conn {
+		m.in = nil
+		m.hung = false
+		m.emit("+READY")
+	}
+	return nil
+}
+
+// detach forgets c if it is the attached host
+func (m *Module) detach(c *Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == c {
+		m.conn = nil
+		m.in = nil
+	}
+}
@@ -0,0 +1,173 @@
+package emulator
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLine reads one line from the host side, failing the test if nothing arrives
+func readLine(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	lines := make(chan string, 1)
+	go func() {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			close(lines)
+			return
+		}
+		lines <- line
+	}()
+
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			t.Fatal("connection closed while waiting for a line")
+		}
+		return strings.TrimSuffix(line, "\r\n")
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a line")
+	}
+	return ""
+}
+
+// exchange writes a command and returns the first line of the answer
+func exchange(t *testing.T, c *Conn, r *bufio.Reader, cmd string) string {
+	t.Helper()
+	if _, err := c.Write([]byte(cmd)); err != nil {
+		t.Fatalf("write %q: %v", cmd, err)
+	}
+	return readLine(t, r)
+}
+
+// TestCommandDialect checks set and query forms and the result codes
+func TestCommandDialect(t *testing.T) {
+	m := New()
+	c := m.Attach()
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	cases := []struct {
+		cmd  string
+		want string
+	}{
+		{"AT\r\n", "+OK"},
+		{"AT+ADDRESS=120\r\n", "+OK"},
+		{"AT+ADDRESS?\r\n", "+ADDRESS=120"},
+		{"AT+NETWORKID=6\r\n", "+OK"},
+		{"AT+NETWORKID?\r\n", "+NETWORKID=6"},
+		{"AT+NETWORKID=17\r\n", "+ERR=4"},
+		{"AT+BAND=868500000\r\n", "+OK"},
+		{"AT+BAND?\r\n", "+BAND=868500000"},
+		{"AT+PARAMETER=10,7,1,7\r\n", "+OK"},
+		{"AT+PARAMETER?\r\n", "+PARAMETER=10,7,1,7"},
+		{"AT+PARAMETER=13,7,1,7\r\n", "+ERR=4"},
+		{"AT+MODE=1\r\n", "+OK"},
+		{"AT+MODE?\r\n", "+MODE=1"},
+		{"AT+CPIN=FABC0002EEDCAA90FABC0002EEDCAA90\r\n", "+OK"},
+		{"AT+CPIN?\r\n", "+CPIN=FABC0002EEDCAA90FABC0002EEDCAA90"},
+		{"AT+CRFOP=10\r\n", "+OK"},
+		{"AT+CRFOP?\r\n", "+CRFOP=10"},
+		{"AT+VER?\r\n", "+VER=RYLR89C_V1.2.7"},
+		{"AT+UID?\r\n", "+UID=000000000000000000000000"},
+		{"AT+SEND=50,5,HELLO\r\n", "+OK"},
+		{"AT+SEND=50,6,HELLO\r\n", "+ERR=4"},
+		{"AT+SEND=50,241," + strings.Repeat("x", 241) + "\r\n", "+ERR=13"},
+		{"AT\n", "+ERR=1"},
+		{"XT+ADDRESS?\r\n", "+ERR=2"},
+		{"AT+ADDRESS\r\n", "+ERR=3"},
+		{"AT+BOGUS?\r\n", "+ERR=4"},
+	}
+
+	for _, tc := range cases {
+		if got := exchange(t, c, r, tc.cmd); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+
+	sent := m.Sent()
+	if len(sent) != 1 || sent[0].Destination != 50 || string(sent[0].Data) != "HELLO" || sent[0].Source != 120 {
+		t.Errorf("unexpected sent frames: %+v", sent)
+	}
+}
+
+// TestResetAndFactory checks the multi-line answers and that FACTORY restores defaults
+func TestResetAndFactory(t *testing.T) {
+	m := New()
+	c := m.Attach()
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	if got := exchange(t, c, r, "AT+RESET\r\n"); got != "+RESET" {
+		t.Fatalf("got %q, want +RESET", got)
+	}
+	if got := readLine(t, r); got != "+READY" {
+		t.Fatalf("got %q, want +READY", got)
+	}
+
+	exchange(t, c, r, "AT+ADDRESS=7\r\n")
+	if got := exchange(t, c, r, "AT+FACTORY\r\n"); got != "+FACTORY" {
+		t.Fatalf("got %q, want +FACTORY", got)
+	}
+	if got := m.State().Address; got != 0 {
+		t.Errorf("address after factory reset = %d, want 0", got)
+	}
+}
+
+// TestHang checks that a hung module ignores commands until its reset pin is pulsed
+func TestHang(t *testing.T) {
+	m := New()
+	c := m.Attach()
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	m.Hang()
+	c.Write([]byte("AT+RESET\r\n"))
+	c.SetRTS(false)
+	c.SetRTS(true)
+	if got := readLine(t, r); got != "+READY" {
+		t.Fatalf("got %q, want +READY", got)
+	}
+	if got := exchange(t, c, r, "AT\r\n"); got != "+OK" {
+		t.Fatalf("got %q, want +OK", got)
+	}
+}
+
+// TestBaudRateMismatch checks that the module goes silent until the host follows an IPR change
+func TestBaudRateMismatch(t *testing.T) {
+	m := New()
+	c := m.Attach()
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	if got := exchange(t, c, r, "AT+IPR=9600\r\n"); got != "+OK" {
+		t.Fatalf("got %q, want +OK", got)
+	}
+
+	// still at 115200 on the host, the command is lost
+	c.Write([]byte("AT\r\n"))
+	c.SetBaudRate(9600)
+	if got := exchange(t, c, r, "AT\r\n"); got != "+OK" {
+		t.Fatalf("got %q, want +OK", got)
+	}
+}
+
+// TestInject checks that injected frames are reported as +RCV
+func TestInject(t *testing.T) {
+	m := New()
+	c := m.Attach()
+	defer c.Close()
+	r := bufio.NewReader(c)
+
+	m.Inject(50, []byte("HELLO"), -99, 40)
+	if got := readLine(t, r); got != "+RCV=50,5,HELLO,-99,40" {
+		t.Fatalf("got %q", got)
+	}
+
+	// frames for another address are not reported
+	if m.Deliver(Frame{Source: 1, Destination: 9, Data: []byte("x")}, -50, 10) {
+		t.Fatal("frame for address 9 delivered to address 0")
+	}
+}
@@ -0,0 +1,128 @@
+package emulator
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTY serves a module on a Linux pseudo-terminal so it can be opened like a device file
+type PTY struct {
+	Path   string // slave device path, pass it to krylr896.CreateConnection
+	master *os.File
+	slave  *os.File // held open so the master survives the host closing and reopening the device
+	conn   *Conn
+	mu     sync.Mutex
+	baud   int // last host baud rate seen on the slave termios
+}
+
+// ServePTY attaches the module to a new pseudo-terminal, the host's baud rate is taken from the
+// slave's termios so rates set through serial.Mode take effect on the emulated UART
+func (m *Module) ServePTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unlockpt: %w", err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("ptsname: %w", err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", n)
+
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	state := m.State()
+	if err := makeRaw(int(slave.Fd()), state.BaudRate); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("configure %s: %w", path, err)
+	}
+
+	p := &PTY{Path: path, master: master, slave: slave, conn: m.Attach(), baud: state.BaudRate}
+	go p.hostToModule()
+	go p.moduleToHost()
+	return p, nil
+}
+
+// makeRaw puts a terminal in raw 8N1 mode at the given baud rate
+func makeRaw(fd int, baudRate int) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS2)
+	if err != nil {
+		return err
+	}
+
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CBAUD
+	t.Cflag |= unix.CS8 | unix.BOTHER
+	t.Ispeed = uint32(baudRate)
+	t.Ospeed = uint32(baudRate)
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS2, t)
+}
+
+// syncBaud propagates the slave's current baud rate to the emulated UART, ioctls on the master
+// operate on the slave's termios
+func (p *PTY) syncBaud() {
+	t, err := unix.IoctlGetTermios(int(p.master.Fd()), unix.TCGETS2)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rate := int(t.Ospeed); rate != 0 && rate != p.baud {
+		p.baud = rate
+		p.conn.SetBaudRate(rate)
+	}
+}
+
+// hostToModule forwards bytes written to the slave into the module
+func (p *PTY) hostToModule() {
+	buf := make([]byte, 512)
+	for {
+		n, err := p.master.Read(buf)
+		if err != nil {
+			return
+		}
+		p.syncBaud()
+		p.conn.Write(buf[:n])
+	}
+}
+
+// moduleToHost forwards the module's output to the slave
+func (p *PTY) moduleToHost() {
+	buf := make([]byte, 512)
+	for {
+		n, err := p.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := p.master.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// Close detaches the module and removes the pseudo-terminal
+func (p *PTY) Close() error {
+	p.conn.Close()
+	p.slave.Close()
+	return p.master.Close()
+}
@@ -0,0 +1,40 @@
+package emulator
+
+import (
+	"testing"
+
+	krylr896 "github.com/1kharvey/k-rylr896"
+)
+
+// TestPTY drives the emulator through the real serial port code path, including a baud rate change
+func TestPTY(t *testing.T) {
+	m := New()
+	pty, err := m.ServePTY()
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+	defer pty.Close()
+
+	baudRate := krylr896.UartBaudRate_9600
+	lora, errEvent := krylr896.CreateConnection(pty.Path, krylr896.UartBaudRate_115200, krylr896.Configuration{UartBaudRate: &baudRate}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to create connection: %v", errEvent.Err)
+	}
+	lora.CloseConnection()
+
+	if got := m.State().BaudRate; got != baudRate {
+		t.Fatalf("module baud rate = %d, want %d", got, baudRate)
+	}
+
+	// reopen at the new rate
+	address := uint16(42)
+	lora, errEvent = krylr896.CreateConnection(pty.Path, baudRate, krylr896.Configuration{Address: &address}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to reopen at %d: %v", baudRate, errEvent.Err)
+	}
+	defer lora.CloseConnection()
+
+	if got := m.State().Address; got != address {
+		t.Fatalf("module address = %d, want %d", got, address)
+	}
+}
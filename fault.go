@@ -0,0 +1,283 @@
+package krylr896
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultKind selects what a FaultRule does to a line
+type FaultKind int
+
+const (
+	FaultDropLine      FaultKind = iota // a received line is discarded
+	FaultCorruptLine                    // bytes of a received line are flipped, the line ending is kept
+	FaultSplitLine                      // a received line is broken in two by an inserted "\r\n"
+	FaultMergeLines                     // a received line loses its line ending and runs into the next one
+	FaultDelayLine                      // a received line, and everything after it, is held back for Delay
+	FaultSpuriousError                  // an unsolicited +ERR=<Code> line is received before the line
+	FaultDisconnect                     // the link fails after the line, reads and writes return ErrInjectedDisconnect
+	FaultWriteError                     // a written command fails with ErrInjectedWrite and is not sent
+)
+
+// injected fault errors
+var (
+	ErrInjectedDisconnect = errors.New("injected disconnect")
+	ErrInjectedWrite      = errors.New("injected write failure")
+)
+
+// FaultRule describes when and how a fault is injected, FaultWriteError applies to written commands,
+// FaultDisconnect to both directions and every other kind to received lines
+type FaultRule struct {
+	Kind        FaultKind
+	Match       string        // only lines containing Match are considered, every line when empty
+	Nth         int           // fire on the nth matching line only (1 based), 0 to use Probability
+	Probability float64       // chance of firing on each matching line when Nth is 0, 0 fires on every match
+	Delay       time.Duration // hold back time for FaultDelayLine
+	Code        int           // result code for FaultSpuriousError
+}
+
+// appliesTo reports whether the rule's kind acts on lines in the given direction
+func (r FaultRule) appliesTo(direction Direction) bool {
+	switch r.Kind {
+	case FaultDisconnect:
+		return true
+	case FaultWriteError:
+		return direction == DirectionTX
+	}
+	return direction == DirectionRX
+}
+
+// FaultTransport wraps a transport and injects faults according to its rules
+type FaultTransport struct {
+	inner Transport
+	rules []FaultRule
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	rng          *rand.Rand
+	matches      []int  // matching lines seen per rule
+	out          []byte // processed bytes waiting to be read
+	disconnected bool
+	readErr      error // error from the inner transport, returned once out is drained
+	injected     map[FaultKind]int
+}
+
+// NewFaultTransport wraps inner, seed makes probabilistic rules reproducible
+func NewFaultTransport(inner Transport, seed int64, rules ...FaultRule) *FaultTransport {
+	t := &FaultTransport{
+		inner:    inner,
+		rules:    rules,
+		rng:      rand.New(rand.NewSource(seed)),
+		matches:  make([]int, len(rules)),
+		injected: make(map[FaultKind]int),
+	}
+	t.cond = sync.NewCond(&t.mu)
+	go t.pump()
+	return t
+}
+
+// fires reports which rules trigger for a line, caller holds t.mu
+func (t *FaultTransport) fires(direction Direction, line []byte) []FaultRule {
+	var fired []FaultRule
+	for i, rule := range t.rules {
+		if !rule.appliesTo(direction) || !bytes.Contains(line, []byte(rule.Match)) {
+			continue
+		}
+		t.matches[i]++
+
+		switch {
+		case rule.Nth > 0:
+			if t.matches[i] != rule.Nth {
+				continue
+			}
+		case rule.Probability > 0:
+			if t.rng.Float64() >= rule.Probability {
+				continue
+			}
+		}
+		t.injected[rule.Kind]++
+		fired = append(fired, rule)
+	}
+	return fired
+}
+
+// pump reads lines from the inner transport and applies the receive side rules
+func (t *FaultTransport) pump() {
+	var pending []byte
+	buf := make([]byte, 512)
+
+	for {
+		n, err := t.inner.Read(buf)
+		pending = append(pending, buf[:n]...)
+
+		for {
+			idx := bytes.IndexByte(pending, '\n')
+			if idx == -1 {
+				break
+			}
+			line := append([]byte(nil), pending[:idx+1]...)
+			pending = pending[idx+1:]
+			t.receiveLine(line)
+		}
+
+		if err != nil {
+			t.mu.Lock()
+			t.out = append(t.out, pending...)
+			t.readErr = err
+			t.cond.Broadcast()
+			t.mu.Unlock()
+			return
+		}
+	}
+}
+
+// receiveLine applies the rules to one received line and queues the result for Read
+func (t *FaultTransport) receiveLine(line []byte) {
+	t.mu.Lock()
+	if t.disconnected {
+		t.mu.Unlock()
+		return
+	}
+	fired := t.fires(DirectionRX, line)
+
+	var delay time.Duration
+	var prefix []byte
+	drop, disconnect, merge := false, false, false
+	for _, rule := range fired {
+		switch rule.Kind {
+		case FaultDropLine:
+			drop = true
+		case FaultCorruptLine:
+			body := len(bytes.TrimRight(line, "\r\n"))
+			for i := 0; i < 1+body/8; i++ {
+				if body > 0 {
+					line[t.rng.Intn(body)] ^= byte(1 + t.rng.Intn(255))
+				}
+			}
+		case FaultSplitLine:
+			body := len(bytes.TrimRight(line, "\r\n"))
+			if body > 1 {
+				at := 1 + t.rng.Intn(body-1)
+				line = append(line[:at:at], append([]byte("\r\n"), line[at:]...)...)
+			}
+		case FaultMergeLines:
+			merge = true
+		case FaultDelayLine:
+			delay += rule.Delay
+		case FaultSpuriousError:
+			prefix = append(prefix, fmt.Sprintf("+ERR=%d\r\n", rule.Code)...)
+		case FaultDisconnect:
+			disconnect = true
+		}
+	}
+	t.mu.Unlock()
+
+	// holding the pump delays every later line too, keeping the order
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.out = append(t.out, prefix...)
+	if !drop {
+		if merge {
+			line = bytes.TrimRight(line, "\r\n")
+		}
+		t.out = append(t.out, line...)
+	}
+	if disconnect {
+		t.disconnected = true
+	}
+	t.cond.Broadcast()
+}
+
+// Read returns received bytes after faults are applied
+func (t *FaultTransport) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(t.out) == 0 && !t.disconnected && t.readErr == nil {
+		t.cond.Wait()
+	}
+	if len(t.out) > 0 {
+		n := copy(p, t.out)
+		t.out = t.out[n:]
+		return n, nil
+	}
+	if t.disconnected {
+		return 0, ErrInjectedDisconnect
+	}
+	return 0, t.readErr
+}
+
+// Write applies the transmit side rules and passes the command on
+func (t *FaultTransport) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	if t.disconnected {
+		t.mu.Unlock()
+		return 0, ErrInjectedDisconnect
+	}
+	fired := t.fires(DirectionTX, p)
+	t.mu.Unlock()
+
+	disconnect := false
+	for _, rule := range fired {
+		switch rule.Kind {
+		case FaultWriteError:
+			return 0, ErrInjectedWrite
+		case FaultDisconnect:
+			disconnect = true
+		}
+	}
+
+	n, err := t.inner.Write(p)
+	if disconnect {
+		t.mu.Lock()
+		t.disconnected = true
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	}
+	return n, err
+}
+
+// Close closes the inner transport
+func (t *FaultTransport) Close() error {
+	return t.inner.Close()
+}
+
+// SetBaudRate passes through to the inner transport
+func (t *FaultTransport) SetBaudRate(baudRate int) error {
+	return setTransportBaudRate(t.inner, baudRate)
+}
+
+// SetDTR passes through to the inner transport
+func (t *FaultTransport) SetDTR(dtr bool) error {
+	return setTransportDTR(t.inner, dtr)
+}
+
+// SetRTS passes through to the inner transport
+func (t *FaultTransport) SetRTS(rts bool) error {
+	return setTransportRTS(t.inner, rts)
+}
+
+// Injected returns how many faults of a kind have fired
+func (t *FaultTransport) Injected(kind FaultKind) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.injected[kind]
+}
+
+// String names the fault kind
+func (k FaultKind) String() string {
+	names := []string{"drop", "corrupt", "split", "merge", "delay", "spurious-error", "disconnect", "write-error"}
+	if int(k) < len(names) {
+		return names[k]
+	}
+	return fmt.Sprintf("fault(%d)", int(k))
+}
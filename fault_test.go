@@ -0,0 +1,233 @@
+package krylr896
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// faultConnection connects to an emulated module through a fault transport
+func faultConnection(t *testing.T, rules ...FaultRule) (*lora, *emulator.Module, *FaultTransport) {
+	t.Helper()
+	module := emulator.New()
+	faults := NewFaultTransport(module.Attach(), 1, rules...)
+	lora, err := CreateConnectionTransport(faults, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	t.Cleanup(func() { lora.CloseConnection() })
+	return lora, module, faults
+}
+
+// nextError waits for an event on the Errors channel
+func nextError(t *testing.T, lora *lora) ErrorEvent {
+	t.Helper()
+	select {
+	case errEvent := <-lora.Errors:
+		return errEvent
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for an error event")
+	}
+	return ErrorEvent{}
+}
+
+// faultUART wraps the UART of an emulated module in a fault transport, for tests of the transport alone
+func faultUART(t *testing.T, seed int64, rules ...FaultRule) (*emulator.Module, *FaultTransport) {
+	t.Helper()
+	module := emulator.New()
+	faults := NewFaultTransport(module.Attach(), seed, rules...)
+	t.Cleanup(func() { faults.Close() })
+	return module, faults
+}
+
+// readLines reads lines from r until one contains until, failing the test after a second
+func readLines(t *testing.T, r io.Reader, until string) []string {
+	t.Helper()
+	done := make(chan []string, 1)
+	go func() {
+		var lines []string
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+			if strings.Contains(line, until) {
+				done <- lines
+				return
+			}
+		}
+	}()
+	select {
+	case lines := <-done:
+		return lines
+	case <-time.After(time.Second):
+		t.Fatalf("no line containing %q within a second", until)
+	}
+	return nil
+}
+
+// TestFaultDropLine checks that a dropped line never arrives and later lines do
+func TestFaultDropLine(t *testing.T) {
+	lora, module, faults := faultConnection(t, FaultRule{Kind: FaultDropLine, Match: ",lost,"})
+
+	module.Inject(5, []byte("lost"), -60, 7)
+	module.Inject(5, []byte("kept"), -60, 7)
+	select {
+	case data := <-lora.RecievedData:
+		if string(data.Data[:data.Length]) != "kept" {
+			t.Fatalf("dropped frame delivered: %+v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the frame after the drop")
+	}
+	if faults.Injected(FaultDropLine) != 1 {
+		t.Fatalf("expected one drop, got %d", faults.Injected(FaultDropLine))
+	}
+}
+
+// TestFaultCorruptLine checks that a corrupted line keeps its length and line ending but not its content
+func TestFaultCorruptLine(t *testing.T) {
+	module, faults := faultUART(t, 1, FaultRule{Kind: FaultCorruptLine, Match: "+RCV="})
+
+	want := "+RCV=5,5,hello,-60,7\r\n"
+	module.Inject(5, []byte("hello"), -60, 7)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(faults, got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(got) == want || !strings.HasSuffix(string(got), "\r\n") {
+		t.Fatalf("expected a corrupted line ending in \\r\\n, got %q", got)
+	}
+}
+
+// TestFaultMergeLines checks that a merged line runs into the next one
+func TestFaultMergeLines(t *testing.T) {
+	module, faults := faultUART(t, 1, FaultRule{Kind: FaultMergeLines, Match: ",first,"})
+
+	module.Inject(5, []byte("first"), -60, 7)
+	module.Inject(5, []byte("second"), -60, 7)
+	lines := readLines(t, faults, ",second,")
+	if len(lines) != 1 || lines[0] != "+RCV=5,5,first,-60,7+RCV=5,6,second,-60,7\r\n" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
+// TestFaultDelayLine checks that a delayed line, and the line after it, arrive late and in order
+func TestFaultDelayLine(t *testing.T) {
+	module, faults := faultUART(t, 1, FaultRule{Kind: FaultDelayLine, Match: ",first,", Delay: 100 * time.Millisecond})
+
+	start := time.Now()
+	module.Inject(5, []byte("first"), -60, 7)
+	module.Inject(5, []byte("second"), -60, 7)
+	lines := readLines(t, faults, ",second,")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("lines arrived after %v", elapsed)
+	}
+	if len(lines) != 2 || !strings.Contains(lines[0], ",first,") {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+}
+
+// TestFaultNth checks that a rule with Nth fires on that matching line only
+func TestFaultNth(t *testing.T) {
+	module, faults := faultUART(t, 1, FaultRule{Kind: FaultDropLine, Match: ",p", Nth: 2})
+
+	for i := 1; i <= 3; i++ {
+		module.Inject(5, []byte(fmt.Sprintf("p%d", i)), -60, 7)
+	}
+	module.Inject(5, []byte("end"), -60, 7)
+	lines := readLines(t, faults, ",end,")
+	if len(lines) != 3 || !strings.Contains(lines[0], ",p1,") || !strings.Contains(lines[1], ",p3,") {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if faults.Injected(FaultDropLine) != 1 {
+		t.Fatalf("expected one drop, got %d", faults.Injected(FaultDropLine))
+	}
+}
+
+// TestFaultProbability checks that a probabilistic rule fires on some lines, the same ones for the same seed
+func TestFaultProbability(t *testing.T) {
+	survivors := func(seed int64) []string {
+		module, faults := faultUART(t, seed, FaultRule{Kind: FaultDropLine, Match: ",p", Probability: 0.5})
+		for i := 0; i < 40; i++ {
+			module.Inject(5, []byte(fmt.Sprintf("p%02d", i)), -60, 7)
+		}
+		module.Inject(5, []byte("end"), -60, 7)
+		return readLines(t, faults, ",end,")
+	}
+
+	first := survivors(7)
+	if dropped := 41 - len(first); dropped == 0 || dropped == 40 {
+		t.Fatalf("expected some of 40 lines dropped, %d were", dropped)
+	}
+	if again := survivors(7); !reflect.DeepEqual(first, again) {
+		t.Fatalf("same seed dropped different lines:\n%q\n%q", first, again)
+	}
+	if other := survivors(8); reflect.DeepEqual(first, other) {
+		t.Fatal("another seed dropped the same lines")
+	}
+}
+
+// TestFaultWriteError checks that a failed write is reported to the caller
+func TestFaultWriteError(t *testing.T) {
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultWriteError, Match: "AT+SEND"})
+
+	sendErr := lora.SendMessage(2, []byte("lost"))
+	if sendErr == nil || !errors.Is(sendErr.Err, ErrInjectedWrite) {
+		t.Fatalf("expected an injected write error, got %+v", sendErr)
+	}
+	if sendErr.Code == nil || *sendErr.Code != UNK_ERR {
+		t.Fatalf("expected code %d, got %v", UNK_ERR, sendErr.Code)
+	}
+	if len(module.Sent()) != 0 {
+		t.Fatal("failed command reached the module")
+	}
+}
+
+// TestFaultSpuriousError checks that an unsolicited error code reaches the Errors channel
+func TestFaultSpuriousError(t *testing.T) {
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultSpuriousError, Match: "+RCV=", Code: RX_OT})
+
+	module.Inject(5, []byte("hi"), -60, 7)
+	errEvent := nextError(t, lora)
+	if errEvent.Code == nil || *errEvent.Code != RX_OT {
+		t.Fatalf("expected code %d, got %+v", RX_OT, errEvent)
+	}
+	<-lora.RecievedData
+}
+
+// TestFaultSplitLine checks that a broken frame is reported as a parse error rather than delivered
+func TestFaultSplitLine(t *testing.T) {
+	lora, module, faults := faultConnection(t, FaultRule{Kind: FaultSplitLine, Match: "+RCV="})
+
+	module.Inject(5, []byte("hello"), -60, 7)
+	errEvent := nextError(t, lora)
+	var parseErr *FrameParseError
+	if !errors.As(errEvent.Err, &parseErr) {
+		t.Fatalf("expected a frame parse error, got %+v", errEvent)
+	}
+	if faults.Injected(FaultSplitLine) != 1 {
+		t.Fatalf("expected one split, got %d", faults.Injected(FaultSplitLine))
+	}
+}
+
+// TestFaultDisconnect checks that a link failure is reported on the Errors channel
+func TestFaultDisconnect(t *testing.T) {
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultDisconnect, Match: "+RCV="})
+
+	module.Inject(5, []byte("last"), -60, 7)
+	<-lora.RecievedData
+	errEvent := nextError(t, lora)
+	if !errors.Is(errEvent.Err, ErrInjectedDisconnect) {
+		t.Fatalf("expected an injected disconnect, got %+v", errEvent)
+	}
+}
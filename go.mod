@@ -3,7 +3,8 @@ module github.com/1kharvey/k-rylr896
 go 1.25.4
 
 require (
-	github.com/creack/goselect v0.1.2 // indirect
-	go.bug.st/serial v1.6.4 // indirect
-	golang.org/x/sys v0.19.0 // indirect
+	go.bug.st/serial v1.6.4
+	golang.org/x/sys v0.19.0
 )
+
+require github.com/creack/goselect v0.1.2 // indirect
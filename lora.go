@@ -1,20 +1,41 @@
 package krylr896
 
 import (
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
-
-	"go.bug.st/serial"
+	"sync"
 )
 
+// ErrClosed is returned for commands sent after, or still pending at, Close
+var ErrClosed = errors.New("connection closed")
+
 type lora struct {
-	Errors       chan ErrorEvent   // read uncategorized errors
-	RecievedData chan RecievedData // read recieved messages
-	Commands     chan Command      // commands are written to here by the user or internally
-	port         serial.Port
-	IS_DEBUG     bool                         // enable debug logging
-	debugName    string                       // debug name prefix for logging
+	Errors       chan ErrorEvent               // read uncategorized errors
+	RecievedData chan RecievedData             // read recieved messages
+	Commands     chan Command                  // commands are written to here by the user or internally
+	LinkEvents   chan LinkEvent                // read changes in the state of the link
+	port         Transport                     // replaced with reader by the command loop on reconnect, under mu
+	reader       *portReader                   // background reader of port lines
+	reconnect    *ReconnectOptions             // reopens the link after a port failure, nil to give up
+	watchdog     *WatchdogOptions              // probes an idle link and resets an unresponsive module, nil if disabled
+	queue        *commandQueue                 // commands waiting to be sent
+	IS_DEBUG     bool                          // enable debug logging
+	debugName    string                        // debug name prefix for logging
 	debugFunc    func(name string, msg string) // debug callback function
+
+	closed    chan struct{} // closed by Close
+	runDone   chan struct{} // closed when the command loop exits
+	closeOnce sync.Once
+	closeErr  error
+
+	mu       sync.Mutex    // guards the fields below
+	baudRate int           // host side baud rate, 0 if unknown
+	timing   CommandTiming // command timeouts and pacing
+	params   *Parameters   // RF parameters last applied, nil if unknown
+	codec    PayloadCodec  // message data encoding, nil if none
+	applied  Configuration // every field the module has accepted, reapplied after a reconnect
+	caps     *Capabilities // limits of the identified model, nil until DeviceInfo succeeds
 }
 
 // debugLog logs a debug message using the debug callback
@@ -25,181 +46,375 @@ func (Lora *lora) debugLog(format string, args ...interface{}) {
 	}
 }
 
-// createConnectionInternal is the internal connection creation function
-func createConnectionInternal(serialInterfaceName string, baudRate int, config Configuration, buffLen int, debug bool, debugName string, debugFunc func(string, string)) (Lora *lora, errEvent *ErrorEvent) {
-	mode := &serial.Mode{
-		BaudRate: baudRate,
-		DataBits: 8,
-		Parity:   serial.NoParity,
-		StopBits: serial.OneStopBit,
-	}
-
-	port, err := serial.Open(serialInterfaceName, mode)
-	if err != nil {
-		return nil, &ErrorEvent{Code: nil, Err: err}
+// createConnectionInternal is the internal connection creation function, baudRate is the rate the
+// transport is currently at (0 if unknown, the transport is asked when it implements BaudRateReporter)
+func createConnectionInternal(transport Transport, baudRate int, config Configuration, buffLen int, opts ConnectionOptions) (Lora *lora, errEvent *ErrorEvent) {
+	if baudRate == 0 {
+		baudRate = transportBaudRate(transport)
 	}
-
 	Lora = &lora{
 		Commands:     make(chan Command, buffLen),
 		Errors:       make(chan ErrorEvent, buffLen),
 		RecievedData: make(chan RecievedData, buffLen),
-		port:         port,
-		IS_DEBUG:     debug,
-		debugName:    debugName,
-		debugFunc:    debugFunc,
+		LinkEvents:   make(chan LinkEvent, buffLen),
+		port:         transport,
+		IS_DEBUG:     opts.Debug,
+		debugName:    opts.DebugName,
+		debugFunc:    opts.DebugFunc,
+		baudRate:     baudRate,
+		closed:       make(chan struct{}),
+		runDone:      make(chan struct{}),
+	}
+	if opts.Timing != nil {
+		Lora.timing = *opts.Timing
+	}
+	Lora.codec = opts.PayloadCodec
+	if opts.Reconnect != nil {
+		if opts.Reconnect.Dial == nil {
+			transport.Close()
+			return nil, &ErrorEvent{Code: nil, Err: fmt.Errorf("reconnect needs a Dial function for this transport")}
+		}
+		reconnect := *opts.Reconnect
+		Lora.reconnect = &reconnect
+	}
+	if opts.Watchdog != nil {
+		watchdog := *opts.Watchdog
+		Lora.watchdog = &watchdog
+	}
+	Lora.reader = startPortReader(transport, Lora.debugLog)
+	Lora.queue = newCommandQueue(Lora.closed)
+
+	// find the module before the command loop takes over the reader
+	if opts.AutoBaud {
+		if errEvent := Lora.autoBaud(opts.RestoreBaud); errEvent != nil {
+			transport.Close()
+			Lora.reader.stop()
+			return nil, errEvent
+		}
 	}
 
 	// start run in background
 	go run(Lora)
 
+	// identify the model so the configuration is checked against its limits
+	if opts.IdentifyModel {
+		info, errEvent := Lora.DeviceInfo()
+		if errEvent != nil {
+			Lora.CloseConnection()
+			return nil, &ErrorEvent{Code: errEvent.Code, Err: fmt.Errorf("failed to identify module: %w", errEvent.Err)}
+		}
+		Lora.debugLog("Connected to %s, firmware %s, UID %s", info.Model, info.Version, info.UID)
+	}
+
 	// set configuration
 	if errEvent := Lora.SetConfig(config); errEvent != nil {
 		Lora.CloseConnection()
 		return nil, &ErrorEvent{Code: errEvent.Code, Err: fmt.Errorf("failed to set configuration: %w", errEvent.Err)}
 	}
 
+	Lora.emitLink(LinkEvent{State: LinkConnected})
 	return Lora, nil
 }
 
+// autoBaud probes the requested rate and then the other supported rates until the module answers,
+// optionally switching the module back to the requested rate
+func (Lora *lora) autoBaud(restore bool) *ErrorEvent {
+	requested := Lora.baudRate
+	var rates []int
+	if requested != 0 {
+		rates = append(rates, requested)
+	}
+	for _, rate := range UartBaudRates {
+		if rate != requested {
+			rates = append(rates, rate)
+		}
+	}
+
+	// wrappers such as NewRecordingTransport always have SetBaudRate, so whether the rate can be searched
+	// is only known by trying
+	if err := setTransportBaudRate(Lora.port, rates[0]); errors.Is(err, ErrNotSupported) {
+		// nothing to search, only check that the module answers
+		if _, err := probeBaudRate(Lora.port, Lora.reader, []int{requested}); err != nil {
+			return &ErrorEvent{Code: nil, Err: fmt.Errorf("auto-baud failed: %w", err)}
+		}
+		return nil
+	} else if err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("auto-baud failed: %w", err)}
+	}
+
+	detected, err := probeBaudRate(Lora.port, Lora.reader, rates)
+	if err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("auto-baud failed: %w", err)}
+	}
+	Lora.debugLog("Auto-baud detected module at %d baud", detected)
+	Lora.setBaudRate(detected)
+
+	if !restore || requested == 0 || detected == requested {
+		return nil
+	}
+
+	// the module answers at the detected rate, then switches
+	if _, err := probeCommand(Lora.port, Lora.reader, fmt.Sprintf("AT+IPR=%d", requested), probeTimeout, nil); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("failed to restore baud rate %d: %w", requested, err)}
+	}
+	if err := setTransportBaudRate(Lora.port, requested); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("failed to restore baud rate %d: %w", requested, err)}
+	}
+	if _, err := probeBaudRate(Lora.port, Lora.reader, []int{requested}); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at restored baud rate %d: %w", requested, err)}
+	}
+	Lora.debugLog("Restored module baud rate to %d", requested)
+	Lora.setBaudRate(requested)
+	return nil
+}
+
+// switchBaudRate moves the host side to a new baud rate after the module accepted AT+IPR, verifies
+// the link with a probe and rolls the host back if the module cannot be reached, it runs inside the
+// command loop so no other command can interleave
+func (Lora *lora) switchBaudRate(baudRate int) *ErrorEvent {
+	previous := Lora.BaudRate()
+	unsolicited := Lora.handleUnsolicited
+
+	if err := setTransportBaudRate(Lora.port, baudRate); err != nil {
+		if !errors.Is(err, ErrNotSupported) {
+			return &ErrorEvent{Code: nil, Err: fmt.Errorf("failed to switch host to %d baud: %w", baudRate, err)}
+		}
+
+		// the host cannot follow, e.g. a raw TCP bridge, so the link only survives if the far end adapts
+		for attempt := 0; attempt < 2; attempt++ {
+			if _, err := probeCommand(Lora.port, Lora.reader, "AT", probeTimeout, unsolicited); err == nil {
+				Lora.debugLog("Module still reachable after switching to %d baud", baudRate)
+				return nil
+			}
+		}
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at %d baud and the transport cannot change its rate", baudRate)}
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err := probeCommand(Lora.port, Lora.reader, "AT", probeTimeout, unsolicited); err == nil {
+			Lora.debugLog("Host baud rate switched to %d", baudRate)
+			Lora.setBaudRate(baudRate)
+			return nil
+		}
+	}
+
+	if previous == 0 {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at %d baud and previous rate unknown", baudRate)}
+	}
+	if err := setTransportBaudRate(Lora.port, previous); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at %d baud, rollback to %d failed: %w", baudRate, previous, err)}
+	}
+	if _, err := probeCommand(Lora.port, Lora.reader, "AT", probeTimeout, unsolicited); err != nil {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at %d or %d baud", baudRate, previous)}
+	}
+	return &ErrorEvent{Code: nil, Err: fmt.Errorf("module not reachable at %d baud, host rolled back to %d", baudRate, previous)}
+}
+
+// BaudRate returns the host side baud rate the module was last reached at, 0 if unknown
+func (Lora *lora) BaudRate() int {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	return Lora.baudRate
+}
+
+// setBaudRate records the host side baud rate
+func (Lora *lora) setBaudRate(baudRate int) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	Lora.baudRate = baudRate
+}
+
 // CreateConnection attaches to a uart serial port, and a desired buffer length and returns a lora object
 func CreateConnection(serialInterfaceName string, baudRate int, config Configuration, buffLen int) (Lora *lora, errEvent *ErrorEvent) {
-	return createConnectionInternal(serialInterfaceName, baudRate, config, buffLen, false, "", nil)
+	return CreateConnectionWithOptions(serialInterfaceName, baudRate, config, buffLen, ConnectionOptions{})
 }
 
 // CreateConnectionDEBUG creates a connection with debug logging enabled
 func CreateConnectionDEBUG(serialInterfaceName string, baudRate int, config Configuration, buffLen int, debugName string, debugFunc func(string, string)) (Lora *lora, errEvent *ErrorEvent) {
-	return createConnectionInternal(serialInterfaceName, baudRate, config, buffLen, true, debugName, debugFunc)
+	return CreateConnectionWithOptions(serialInterfaceName, baudRate, config, buffLen, ConnectionOptions{Debug: true, DebugName: debugName, DebugFunc: debugFunc})
+}
+
+// CreateConnectionWithOptions attaches to a uart serial port with optional behaviour such as auto-baud
+func CreateConnectionWithOptions(serialInterfaceName string, baudRate int, config Configuration, buffLen int, opts ConnectionOptions) (Lora *lora, errEvent *ErrorEvent) {
+	transport, err := openSerialTransport(serialInterfaceName, baudRate)
+	if err != nil {
+		return nil, &ErrorEvent{Code: nil, Err: err}
+	}
+	if opts.Reconnect != nil && opts.Reconnect.Dial == nil {
+		reconnect := *opts.Reconnect
+		reconnect.Dial = func(baudRate int) (Transport, error) {
+			return openSerialTransport(serialInterfaceName, baudRate)
+		}
+		opts.Reconnect = &reconnect
+	}
+	return createConnectionInternal(transport, baudRate, config, buffLen, opts)
+}
+
+// CreateConnectionTransport attaches to an already open transport, the transport is closed with the connection
+func CreateConnectionTransport(transport Transport, config Configuration, buffLen int) (Lora *lora, errEvent *ErrorEvent) {
+	return createConnectionInternal(transport, 0, config, buffLen, ConnectionOptions{})
+}
+
+// CreateConnectionTransportDEBUG attaches to an already open transport with debug logging enabled
+func CreateConnectionTransportDEBUG(transport Transport, config Configuration, buffLen int, debugName string, debugFunc func(string, string)) (Lora *lora, errEvent *ErrorEvent) {
+	return createConnectionInternal(transport, 0, config, buffLen, ConnectionOptions{Debug: true, DebugName: debugName, DebugFunc: debugFunc})
 }
 
-// CloseConnection closes the connection to the LoRa module
+// CreateConnectionTransportWithOptions attaches to an already open transport with optional behaviour,
+// baudRate is the rate the transport is at (0 if unknown or not applicable)
+func CreateConnectionTransportWithOptions(transport Transport, baudRate int, config Configuration, buffLen int, opts ConnectionOptions) (Lora *lora, errEvent *ErrorEvent) {
+	return createConnectionInternal(transport, baudRate, config, buffLen, opts)
+}
+
+// Close closes the connection to the LoRa module, it is safe to call more than once, pending commands
+// fail with ErrClosed and Errors and RecievedData are closed once the background goroutines have exited
+func (Lora *lora) Close() error {
+	Lora.closeOnce.Do(func() {
+		close(Lora.closed)
+
+		// the command loop does not swap the transport once closed is closed
+		Lora.mu.Lock()
+		port, reader := Lora.port, Lora.reader
+		Lora.mu.Unlock()
+
+		Lora.closeErr = port.Close()
+		reader.stop()
+		<-Lora.runDone
+
+		close(Lora.Errors)
+		close(Lora.RecievedData)
+		close(Lora.LinkEvents)
+	})
+	return Lora.closeErr
+}
+
+// CloseConnection closes the connection to the LoRa module, it is the same as Close
 func (Lora *lora) CloseConnection() (err error) {
-	close(Lora.Commands)
-	return Lora.port.Close()
+	return Lora.Close()
 }
 
-// SetConfig applies a configuration to the radio, nil fields are ignored
-func (Lora *lora) SetConfig(config Configuration) *ErrorEvent {
-	// channel to receive command results
+// execute queues a command and waits for its response, a command withdrawn or abandoned because ctx
+// ended is reported as cancelled, onResponse may be nil
+func (Lora *lora) execute(ctx context.Context, cmd Command) CommandResponse {
+	// channel to receive command result, buffered so an abandoned response does not block run()
 	resultChan := make(chan CommandResponse, 1)
+	cmd.ResponseChan = resultChan
+	cmd.ctx = ctx
 
-	// helper function to send a command and wait for response
-	sendCommand := func(cmd string) *ErrorEvent {
-		Lora.Commands <- Command{
-			Text:         cmd,
-			ResponseChan: resultChan,
-		}
+	// a closed connection answers straight away with ErrClosed
+	Lora.queue.push(cmd)
 
-		// wait for response
-		resp := <-resultChan
-		return resp.Error
+	// wait for response
+	select {
+	case resp := <-resultChan:
+		return resp
+	case <-ctx.Done():
+		return CommandResponse{Error: &ErrorEvent{Code: nil, Err: fmt.Errorf("command cancelled: %w", ctx.Err())}}
 	}
+}
 
-	// set ADDRESS if not nil
-	if config.Address != nil {
-		if err := sendCommand(fmt.Sprintf("AT+ADDRESS=%d", *config.Address)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set address: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set address")}
-		}
-	}
+// SendCommand sends a raw AT command, without the line ending, and returns the module's answer
+func (Lora *lora) SendCommand(text string) (string, *ErrorEvent) {
+	return Lora.SendCommandContext(context.Background(), text)
+}
 
-	// set NETWORKID if not nil
-	if config.NetworkID != nil {
-		if err := sendCommand(fmt.Sprintf("AT+NETWORKID=%d", *config.NetworkID)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set network ID: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set network ID")}
-		}
+// SendCommandContext sends a raw AT command, giving up when ctx ends
+func (Lora *lora) SendCommandContext(ctx context.Context, text string) (string, *ErrorEvent) {
+	resp := Lora.execute(ctx, Command{Text: text})
+	return resp.Response, resp.Error
+}
+
+// SendRawCommand writes cmd to Commands, once the connection is closed cmd is answered with ErrClosed
+// instead, so a late sender does not block or wait for an answer that never comes
+func (Lora *lora) SendRawCommand(cmd Command) {
+	select {
+	case Lora.Commands <- cmd:
+	case <-Lora.runDone:
+		respond(cmd, closedResponse(), Lora.closed)
+		return
 	}
 
-	// set BAND if not nil
-	if config.Band != nil {
-		if err := sendCommand(fmt.Sprintf("AT+BAND=%d", *config.Band)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set band: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set band")}
-		}
+	// the command loop fails what is in Commands on its way out, a command that arrived after that is
+	// failed here
+	select {
+	case <-Lora.closed:
+		<-Lora.runDone
+		Lora.failRawCommands()
+	case <-Lora.runDone:
+		Lora.failRawCommands()
+	default:
 	}
+}
 
-	// set PARAMETER if not nil
-	if config.Parameter != nil {
-		cmd := fmt.Sprintf("AT+PARAMETER=%d,%d,%d,%d",
-			config.Parameter.SpreadingFactor,
-			config.Parameter.Bandwidth,
-			config.Parameter.CodingRate,
-			config.Parameter.ProgrammedPreamble)
-		if err := sendCommand(cmd); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set parameter: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set parameter")}
-		}
+// SetConfig applies a configuration to the radio, nil fields are ignored
+func (Lora *lora) SetConfig(config Configuration) *ErrorEvent {
+	return Lora.SetConfigContext(context.Background(), config)
+}
+
+// SetConfigContext applies a configuration to the radio, stopping at the first field when ctx ends.
+// nothing is sent when a field fails ValidateFor with the module's capabilities
+func (Lora *lora) SetConfigContext(ctx context.Context, config Configuration) *ErrorEvent {
+	if err := config.ValidateFor(Lora.Capabilities()); err != nil {
+		return &ErrorEvent{Code: nil, Err: err}
 	}
 
-	// set MODE if not nil
-	if config.Mode != nil {
-		if err := sendCommand(fmt.Sprintf("AT+MODE=%d", *config.Mode)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set mode: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set mode")}
+	return Lora.applyConfig(ctx, config)
+}
+
+// applyConfig sends the non-nil fields of config in configFields order without validating them, stopping
+// at the first field that fails
+func (Lora *lora) applyConfig(ctx context.Context, config Configuration) *ErrorEvent {
+	for _, field := range configFields {
+		single, ok := configField(config, field)
+		if !ok {
+			continue
 		}
-	}
 
-	// set IPR (UART baud rate) if not nil
-	if config.UartBaudRate != nil {
-		if err := sendCommand(fmt.Sprintf("AT+IPR=%d", *config.UartBaudRate)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set UART baud rate: %w", err.Err)}
+		cmd := Command{Text: configCommands(single)[0]}
+		if field == "IPR" {
+			// the module answers at the old rate and then switches, so the host side follows and checks
+			// the link before any other command is sent
+			baudRate := *config.UartBaudRate
+			cmd.onResponse = func(CommandResponse) *ErrorEvent {
+				return Lora.switchBaudRate(baudRate)
 			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set UART baud rate")}
 		}
-	}
-
-	// set CPIN (encryption key) if not nil
-	if config.EncryptionKey != nil {
-		hexKey := hex.EncodeToString(config.EncryptionKey[:])
-		if err := sendCommand(fmt.Sprintf("AT+CPIN=%s", hexKey)); err != nil {
+		if err := Lora.execute(ctx, cmd).Error; err != nil {
 			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set encryption key: %w", err.Err)}
+				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set %s: %w", configFieldLabels[field], err.Err)}
 			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set encryption key")}
+			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set %s", configFieldLabels[field])}
 		}
-	}
 
-	// set CRFOP (RF output power) if not nil
-	if config.RFOutputPower != nil {
-		if err := sendCommand(fmt.Sprintf("AT+CRFOP=%d", *config.RFOutputPower)); err != nil {
-			if err.Err != nil {
-				return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set RF output power: %w", err.Err)}
-			}
-			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to set RF output power")}
+		if field == "PARAMETER" {
+			Lora.setParameters(*config.Parameter)
 		}
+		Lora.recordApplied(single)
 	}
-
 	return nil
 }
 
 // SendMessage sends bytes to specified address
 func (Lora *lora) SendMessage(address uint16, data []byte) *ErrorEvent {
-	if len(data) > 240 {
-		return &ErrorEvent{Code: nil, Err: fmt.Errorf("data length %d exceeds maximum of 240 bytes", len(data))}
-	}
+	return Lora.SendMessageContext(context.Background(), address, data)
+}
 
-	// channel to receive command result
-	resultChan := make(chan CommandResponse, 1)
+// SendMessageContext sends bytes to specified address, giving up when ctx ends
+func (Lora *lora) SendMessageContext(ctx context.Context, address uint16, data []byte) *ErrorEvent {
+	return Lora.SendMessageWithOptions(ctx, address, data, SendOptions{})
+}
 
-	cmd := fmt.Sprintf("AT+SEND=%d,%d,%s", address, len(data), string(data))
-	Lora.Commands <- Command{
-		Text:         cmd,
-		ResponseChan: resultChan,
+// SendMessageWithOptions sends bytes to specified address with a queue priority and deadline
+func (Lora *lora) SendMessageWithOptions(ctx context.Context, address uint16, data []byte, opts SendOptions) *ErrorEvent {
+	if limit := Lora.MaxPayload(); len(data) > limit {
+		return &ErrorEvent{Code: nil, Err: fmt.Errorf("data length %d exceeds maximum of %d bytes", len(data), limit)}
+	}
+	if codec := Lora.payloadCodec(); codec != nil {
+		data = codec.Encode(data)
 	}
 
-	// wait for response
-	resp := <-resultChan
+	cmd := fmt.Sprintf("AT+SEND=%d,%d,%s", address, len(data), string(data))
+	resp := Lora.execute(ctx, Command{Text: cmd, Priority: opts.Priority, Deadline: opts.Deadline})
 	if resp.Error != nil {
 		return &ErrorEvent{Code: resp.Error.Code, Err: fmt.Errorf("send failed: %w", resp.Error.Err)}
 	}
@@ -0,0 +1,408 @@
+package krylr896
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestEmulatorConfiguration applies a full configuration to an emulated module
+func TestEmulatorConfiguration(t *testing.T) {
+	address := uint16(1)
+	networkID := uint8(5)
+	band := BandUSA
+	mode := MODE_TRX
+	rfPower := uint8(10)
+	key := [16]byte{0xfa, 0xbc, 0x00, 0x02}
+	params := Parameters{
+		SpreadingFactor:    9,
+		Bandwidth:          Bandwidth125KHz,
+		CodingRate:         1,
+		ProgrammedPreamble: 4,
+	}
+
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{
+		Address:       &address,
+		NetworkID:     &networkID,
+		Band:          &band,
+		Parameter:     &params,
+		Mode:          &mode,
+		EncryptionKey: &key,
+		RFOutputPower: &rfPower,
+	}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	state := module.State()
+	if state.Address != address || state.NetworkID != networkID || state.Band != band ||
+		state.Parameters.SpreadingFactor != 9 || state.RFOutputPower != rfPower || state.Password != key {
+		t.Fatalf("module state not applied: %+v", state)
+	}
+}
+
+// TestEmulatorConfigurationError checks that an out of range value is rejected before it is sent, and
+// that the module's error code surfaces when it is sent anyway
+func TestEmulatorConfigurationError(t *testing.T) {
+	networkID := uint8(17)
+
+	module := emulator.New()
+	_, err := CreateConnectionTransport(module.Attach(), Configuration{NetworkID: &networkID}, 10)
+	if err == nil {
+		t.Fatal("expected an error for network ID 17")
+	}
+	var fieldErr *FieldError
+	if !errors.As(err.Err, &fieldErr) || fieldErr.Field != "NETWORKID" {
+		t.Fatalf("expected a NETWORKID validation error, got %v", err.Err)
+	}
+
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+	_, err = lora.SendCommand("AT+NETWORKID=17")
+	if err == nil || err.Code == nil || *err.Code != UNK_CMD {
+		t.Fatalf("expected code %d, got %+v", UNK_CMD, err)
+	}
+}
+
+// TestEmulatorSendReceive sends and receives a message through an emulated module
+func TestEmulatorSendReceive(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	if sendErr := lora.SendMessage(2, []byte("Hello, LoRa!")); sendErr != nil {
+		t.Fatalf("Failed to send message: %v", sendErr.Err)
+	}
+	sent := module.Sent()
+	if len(sent) != 1 || sent[0].Destination != 2 || string(sent[0].Data) != "Hello, LoRa!" {
+		t.Fatalf("unexpected frames: %+v", sent)
+	}
+
+	module.Inject(50, []byte("HELLO"), -99, 40)
+	select {
+	case msg := <-lora.RecievedData:
+		if msg.Address != 50 || string(msg.Data[:msg.Length]) != "HELLO" ||
+			msg.ReceivedSignalStrengthIndicator != -99 || msg.SignalToNoiseRatio != 40 {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+}
+
+// TestEmulatorAutoBaud connects to a module left at 9600 baud while asking for 115200
+func TestEmulatorAutoBaud(t *testing.T) {
+	for _, restore := range []bool{false, true} {
+		state := emulator.DefaultState()
+		state.BaudRate = UartBaudRate_9600
+		module := emulator.NewWithState(state)
+		conn := module.Attach()
+		conn.SetBaudRate(UartBaudRate_115200)
+
+		address := uint16(3)
+		lora, err := CreateConnectionTransportWithOptions(conn, UartBaudRate_115200, Configuration{Address: &address}, 10,
+			ConnectionOptions{AutoBaud: true, RestoreBaud: restore})
+		if err != nil {
+			t.Fatalf("restore=%v: Failed to create connection: %v", restore, err.Err)
+		}
+
+		want := UartBaudRate_9600
+		if restore {
+			want = UartBaudRate_115200
+		}
+		if lora.BaudRate() != want || module.State().BaudRate != want {
+			t.Errorf("restore=%v: host at %d, module at %d, want %d", restore, lora.BaudRate(), module.State().BaudRate, want)
+		}
+		if module.State().Address != address {
+			t.Errorf("restore=%v: configuration not applied after auto-baud", restore)
+		}
+		lora.CloseConnection()
+	}
+}
+
+// TestEmulatorAutoBaudUnknownRate connects with auto-baud to a transport whose rate is not given
+func TestEmulatorAutoBaudUnknownRate(t *testing.T) {
+	state := emulator.DefaultState()
+	state.BaudRate = UartBaudRate_9600
+	module := emulator.NewWithState(state)
+	conn := module.Attach()
+	conn.SetBaudRate(UartBaudRate_9600)
+
+	lora, err := CreateConnectionTransportWithOptions(conn, 0, Configuration{}, 10, ConnectionOptions{AutoBaud: true})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	if lora.BaudRate() != UartBaudRate_9600 {
+		t.Fatalf("host at %d, want %d", lora.BaudRate(), UartBaudRate_9600)
+	}
+}
+
+// fixedRateConn is an emulated UART that cannot change its rate
+type fixedRateConn struct {
+	io.ReadWriteCloser
+}
+
+// TestEmulatorAutoBaudWrapped checks that auto-baud from an unknown rate falls back to the current rate
+// when a wrapper hides that the transport underneath cannot change rates
+func TestEmulatorAutoBaudWrapped(t *testing.T) {
+	for _, wrap := range []func(Transport) Transport{
+		func(t Transport) Transport { return NewRecordingTransport(t, io.Discard) },
+		func(t Transport) Transport { return NewFaultTransport(t, 1) },
+	} {
+		transport := wrap(fixedRateConn{emulator.New().Attach()})
+		lora, err := CreateConnectionTransportWithOptions(transport, 0, Configuration{}, 10, ConnectionOptions{AutoBaud: true})
+		if err != nil {
+			t.Fatalf("%T: Failed to create connection: %v", transport, err.Err)
+		}
+		lora.CloseConnection()
+	}
+}
+
+// slowAdapter is a UART adapter that cannot run below 1200 baud
+type slowAdapter struct {
+	*emulator.Conn
+}
+
+// SetBaudRate silently clamps the rate like a misbehaving adapter
+func (a slowAdapter) SetBaudRate(baudRate int) error {
+	if baudRate < UartBaudRate_1200 {
+		baudRate = UartBaudRate_1200
+	}
+	return a.Conn.SetBaudRate(baudRate)
+}
+
+// TestEmulatorBaudRateSwitch checks that an IPR change is verified and reported when the host cannot follow
+func TestEmulatorBaudRateSwitch(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransportWithOptions(slowAdapter{module.Attach()}, UartBaudRate_115200, Configuration{}, 10, ConnectionOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	baudRate := UartBaudRate_4800
+	if err := lora.SetConfig(Configuration{UartBaudRate: &baudRate}); err != nil {
+		t.Fatalf("switch to %d: %v", baudRate, err.Err)
+	}
+	if lora.BaudRate() != baudRate {
+		t.Fatalf("host at %d, want %d", lora.BaudRate(), baudRate)
+	}
+
+	baudRate = UartBaudRate_300
+	err = lora.SetConfig(Configuration{UartBaudRate: &baudRate})
+	if err == nil || !strings.Contains(err.Err.Error(), "not reachable at 300") {
+		t.Fatalf("expected an unreachable error, got %+v", err)
+	}
+	if lora.BaudRate() != UartBaudRate_4800 {
+		t.Fatalf("host at %d after rollback, want %d", lora.BaudRate(), UartBaudRate_4800)
+	}
+}
+
+// busyChannel injects a received message ahead of the answer to every AT+SEND
+type busyChannel struct {
+	*emulator.Conn
+	module *emulator.Module
+}
+
+// Write queues the message before the command reaches the module
+func (b busyChannel) Write(p []byte) (int, error) {
+	if strings.HasPrefix(string(p), "AT+SEND=") {
+		b.module.Inject(50, []byte("HELLO"), -99, 40)
+	}
+	return b.Conn.Write(p)
+}
+
+// TestEmulatorReceiveDuringCommand checks that a message arriving before a command's answer is delivered
+// and the answer still reaches the command
+func TestEmulatorReceiveDuringCommand(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(busyChannel{module.Attach(), module}, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	if sendErr := lora.SendMessage(2, []byte("Hi")); sendErr != nil {
+		t.Fatalf("Failed to send message: %v", sendErr.Err)
+	}
+	select {
+	case msg := <-lora.RecievedData:
+		if msg.Address != 50 || string(msg.Data[:msg.Length]) != "HELLO" {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message received during the command was lost")
+	}
+	select {
+	case errEvent := <-lora.Errors:
+		t.Fatalf("unexpected error: %v", errEvent.Err)
+	default:
+	}
+}
+
+// noisyChannel delivers a line of noise ahead of the answer to every AT+ADDRESS=
+type noisyChannel struct {
+	*emulator.Conn
+	module *emulator.Module
+}
+
+// Write queues the noise before the command reaches the module
+func (n noisyChannel) Write(p []byte) (int, error) {
+	if strings.HasPrefix(string(p), "AT+ADDRESS=") {
+		n.module.InjectRaw([]byte("garbage\r\n"))
+	}
+	return n.Conn.Write(p)
+}
+
+// TestEmulatorNoiseDuringCommand checks that a stray line is not taken as a command's answer
+func TestEmulatorNoiseDuringCommand(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(noisyChannel{module.Attach(), module}, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	address := uint16(3)
+	if err := lora.SetConfig(Configuration{Address: &address}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err.Err)
+	}
+	select {
+	case errEvent := <-lora.Errors:
+		if !strings.Contains(errEvent.Err.Error(), "garbage") {
+			t.Fatalf("expected the noise to be reported, got %v", errEvent.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("noise not reported")
+	}
+	if resp, err := lora.SendCommand("AT+ADDRESS?"); err != nil || strings.TrimSpace(resp) != "+ADDRESS=3" {
+		t.Fatalf("unexpected answer %q, %+v", resp, err)
+	}
+}
+
+// TestEmulatorClose checks that Close fails pending commands, can be repeated and leaves the
+// connection returning ErrClosed
+func TestEmulatorClose(t *testing.T) {
+	lora, _, _ := faultConnection(t, FaultRule{Kind: FaultDropLine, Match: "+OK"})
+
+	pending := make(chan *ErrorEvent, 1)
+	go func() {
+		_, err := lora.SendCommand("AT")
+		pending <- err
+	}()
+	queued := lora.SendAsync(2, []byte("queued"), SendOptions{})
+	time.Sleep(20 * time.Millisecond)
+
+	if err := lora.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	lora.Close()
+	lora.CloseConnection()
+
+	select {
+	case err := <-pending:
+		if err == nil || !errors.Is(err.Err, ErrClosed) {
+			t.Fatalf("expected ErrClosed for the command in flight, got %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("command in flight not failed by Close")
+	}
+	select {
+	case <-queued.Done():
+		if report := queued.Report(); report.Error == nil || !errors.Is(report.Error.Err, ErrClosed) {
+			t.Fatalf("expected ErrClosed for the queued message, got %+v", report)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued message not failed by Close")
+	}
+
+	if err := lora.SendMessage(2, []byte("late")); err == nil || !errors.Is(err.Err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %+v", err)
+	}
+	address := uint16(1)
+	if err := lora.SetConfig(Configuration{Address: &address}); err == nil || !errors.Is(err.Err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after Close, got %+v", err)
+	}
+
+	// output channels are closed so range loops end
+	for range lora.RecievedData {
+	}
+	for range lora.Errors {
+	}
+}
+
+// TestEmulatorCloseRawCommands checks that Close does not wait for a raw sender that stopped reading,
+// and that raw commands sent afterwards fail with ErrClosed
+func TestEmulatorCloseRawCommands(t *testing.T) {
+	lora, _, _ := faultConnection(t, FaultRule{Kind: FaultDropLine, Match: "+OK"})
+
+	// nobody reads the answer to this one
+	lora.Commands <- Command{Text: "AT", ResponseChan: make(chan CommandResponse)}
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- lora.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on an unread ResponseChan")
+	}
+
+	// more than the channel holds, none of them may block
+	for i := 0; i < 20; i++ {
+		resp := make(chan CommandResponse, 1)
+		sent := make(chan struct{})
+		go func() {
+			lora.SendRawCommand(Command{Text: "AT", ResponseChan: resp})
+			close(sent)
+		}()
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("raw command %d blocked after Close", i)
+		}
+		select {
+		case r := <-resp:
+			if r.Error == nil || !errors.Is(r.Error.Err, ErrClosed) {
+				t.Fatalf("expected ErrClosed, got %+v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("raw command %d not answered after Close", i)
+		}
+	}
+}
+
+// TestEmulatorCloseGoroutines checks that nothing is left running after Close
+func TestEmulatorCloseGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		lora, err := CreateConnectionTransport(emulator.New().Attach(), Configuration{}, 10)
+		if err != nil {
+			t.Fatalf("Failed to create connection: %v", err.Err)
+		}
+		lora.Close()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("%d goroutines before, %d after 20 connections", before, after)
+	}
+}
@@ -0,0 +1,336 @@
+package krylr896
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialTCP connects to a raw TCP serial server such as ser2net in raw mode or an ESP32 bridge,
+// the remote UART speed is fixed by the server
+func DialTCP(address string, timeout time.Duration) (Transport, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+// telnet protocol bytes
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptBinary  = 0
+	telnetOptSGA     = 3
+	telnetOptComPort = 44
+)
+
+// RFC 2217 COM-PORT-OPTION client commands, the server answers with the command + 100
+const (
+	comPortSetBaudRate = 1
+	comPortSetDataSize = 2
+	comPortSetParity   = 3
+	comPortSetStopSize = 4
+	comPortSetControl  = 5
+
+	comPortServerOffset = 100
+
+	comPortParityNone = 1
+	comPortStopOne    = 1
+	comPortDTROn      = 8
+	comPortDTROff     = 9
+	comPortRTSOn      = 11
+	comPortRTSOff     = 12
+)
+
+// rfc2217AckTimeout bounds how long a COM-PORT-OPTION command waits for the server's answer
+const rfc2217AckTimeout = 2 * time.Second
+
+// telnet parser states
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption // after WILL/WONT/DO/DONT
+	telnetStateSB
+	telnetStateSBIAC
+)
+
+// RFC2217Transport is a Telnet COM port control (RFC 2217) client, baud rate and modem line changes
+// are forwarded to the remote UART
+type RFC2217Transport struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	// parser state, only touched by Read
+	state   int
+	verb    byte
+	sb      []byte
+	readBuf []byte
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	acks     map[byte][]byte // latest server answer per COM-PORT-OPTION command
+	baudRate int             // remote UART speed last requested
+}
+
+// DialRFC2217 connects to an RFC 2217 server and configures the remote UART as 8N1 at baudRate
+func DialRFC2217(address string, baudRate int, timeout time.Duration) (*RFC2217Transport, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &RFC2217Transport{conn: conn, readBuf: make([]byte, 512), acks: make(map[byte][]byte), baudRate: baudRate}
+	t.cond = sync.NewCond(&t.mu)
+
+	negotiation := []byte{
+		telnetIAC, telnetWILL, telnetOptComPort,
+		telnetIAC, telnetWILL, telnetOptBinary,
+		telnetIAC, telnetDO, telnetOptBinary,
+		telnetIAC, telnetDO, telnetOptSGA,
+	}
+	if err := t.writeRaw(negotiation); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the server's answers arrive through Read, which the connection's reader drives, so the
+	// initial settings are sent without waiting for acknowledgement
+	if err := t.sendComPort(comPortSetDataSize, []byte{8}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := t.sendComPort(comPortSetParity, []byte{comPortParityNone}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := t.sendComPort(comPortSetStopSize, []byte{comPortStopOne}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := t.sendComPort(comPortSetBaudRate, baudRateBytes(baudRate)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// baudRateBytes encodes a baud rate as the 4 byte network order value RFC 2217 uses
+func baudRateBytes(baudRate int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(baudRate))
+	return b
+}
+
+// writeRaw writes bytes without escaping
+func (t *RFC2217Transport) writeRaw(p []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err := t.conn.Write(p)
+	return err
+}
+
+// sendComPort sends a COM-PORT-OPTION subnegotiation
+func (t *RFC2217Transport) sendComPort(command byte, value []byte) error {
+	msg := []byte{telnetIAC, telnetSB, telnetOptComPort, command}
+	msg = append(msg, escapeIAC(value)...)
+	msg = append(msg, telnetIAC, telnetSE)
+	return t.writeRaw(msg)
+}
+
+// sendComPortAndWait sends a COM-PORT-OPTION command and waits for the server to answer it,
+// this relies on Read being driven by another goroutine
+func (t *RFC2217Transport) sendComPortAndWait(command byte, value []byte) error {
+	t.mu.Lock()
+	delete(t.acks, command+comPortServerOffset)
+	t.mu.Unlock()
+
+	if err := t.sendComPort(command, value); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(rfc2217AckTimeout)
+	timer := time.AfterFunc(rfc2217AckTimeout, func() {
+		t.mu.Lock()
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		if _, ok := t.acks[command+comPortServerOffset]; ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("rfc2217 server did not acknowledge command %d", command)
+		}
+		t.cond.Wait()
+	}
+}
+
+// escapeIAC doubles IAC bytes in data
+func escapeIAC(p []byte) []byte {
+	if bytes.IndexByte(p, telnetIAC) == -1 {
+		return p
+	}
+	escaped := make([]byte, 0, len(p)+1)
+	for _, b := range p {
+		escaped = append(escaped, b)
+		if b == telnetIAC {
+			escaped = append(escaped, telnetIAC)
+		}
+	}
+	return escaped
+}
+
+// Read returns serial data with telnet commands removed, negotiation is answered as it arrives
+func (t *RFC2217Transport) Read(p []byte) (int, error) {
+	for {
+		if len(p) > len(t.readBuf) {
+			p = p[:len(t.readBuf)]
+		}
+		n, err := t.conn.Read(t.readBuf[:len(p)])
+
+		out := 0
+		for _, b := range t.readBuf[:n] {
+			if t.parse(b) {
+				p[out] = b
+				out++
+			}
+		}
+
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+// parse advances the telnet state machine and reports whether b is serial data
+func (t *RFC2217Transport) parse(b byte) bool {
+	switch t.state {
+	case telnetStateData:
+		if b == telnetIAC {
+			t.state = telnetStateIAC
+			return false
+		}
+		return true
+
+	case telnetStateIAC:
+		switch b {
+		case telnetIAC:
+			t.state = telnetStateData
+			return true
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.verb = b
+			t.state = telnetStateOption
+		case telnetSB:
+			t.sb = t.sb[:0]
+			t.state = telnetStateSB
+		default:
+			t.state = telnetStateData
+		}
+
+	case telnetStateOption:
+		t.negotiate(t.verb, b)
+		t.state = telnetStateData
+
+	case telnetStateSB:
+		if b == telnetIAC {
+			t.state = telnetStateSBIAC
+		} else {
+			t.sb = append(t.sb, b)
+		}
+
+	case telnetStateSBIAC:
+		if b == telnetSE {
+			t.subnegotiation(t.sb)
+			t.state = telnetStateData
+		} else {
+			t.sb = append(t.sb, b)
+			t.state = telnetStateSB
+		}
+	}
+	return false
+}
+
+// negotiate answers option requests, only the options asked for at connection are accepted
+func (t *RFC2217Transport) negotiate(verb byte, option byte) {
+	switch verb {
+	case telnetDO:
+		if option != telnetOptComPort && option != telnetOptBinary && option != telnetOptSGA {
+			go t.writeRaw([]byte{telnetIAC, telnetWONT, option})
+		}
+	case telnetWILL:
+		if option != telnetOptBinary && option != telnetOptSGA && option != telnetOptComPort {
+			go t.writeRaw([]byte{telnetIAC, telnetDONT, option})
+		}
+	}
+}
+
+// subnegotiation records the server's COM-PORT-OPTION answers
+func (t *RFC2217Transport) subnegotiation(sb []byte) {
+	if len(sb) < 2 || sb[0] != telnetOptComPort {
+		return
+	}
+	t.mu.Lock()
+	t.acks[sb[1]] = append([]byte(nil), sb[2:]...)
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// Write sends serial data, escaping IAC bytes
+func (t *RFC2217Transport) Write(p []byte) (int, error) {
+	if err := t.writeRaw(escapeIAC(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the network connection
+func (t *RFC2217Transport) Close() error {
+	return t.conn.Close()
+}
+
+// SetBaudRate changes the remote UART speed and waits for the server to confirm it
+func (t *RFC2217Transport) SetBaudRate(baudRate int) error {
+	if err := t.sendComPortAndWait(comPortSetBaudRate, baudRateBytes(baudRate)); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.baudRate = baudRate
+	t.mu.Unlock()
+	return nil
+}
+
+// BaudRate returns the remote UART speed last set
+func (t *RFC2217Transport) BaudRate() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.baudRate
+}
+
+// SetDTR drives the remote DTR line
+func (t *RFC2217Transport) SetDTR(dtr bool) error {
+	value := byte(comPortDTROff)
+	if dtr {
+		value = comPortDTROn
+	}
+	return t.sendComPortAndWait(comPortSetControl, []byte{value})
+}
+
+// SetRTS drives the remote RTS line
+func (t *RFC2217Transport) SetRTS(rts bool) error {
+	value := byte(comPortRTSOff)
+	if rts {
+		value = comPortRTSOn
+	}
+	return t.sendComPortAndWait(comPortSetControl, []byte{value})
+}
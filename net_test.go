@@ -0,0 +1,213 @@
+package krylr896
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// serveRaw bridges one TCP client to an emulated module
+func serveRaw(t *testing.T, module *emulator.Module) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		uart := module.Attach()
+		go io.Copy(conn, uart)
+		io.Copy(uart, conn)
+		uart.Close()
+	}()
+	return listener.Addr().String()
+}
+
+// serveRFC2217 bridges one Telnet COM port control client to an emulated module, baud rate
+// commands are applied to the emulated UART and acknowledged
+func serveRFC2217(t *testing.T, module *emulator.Module) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		uart := module.Attach()
+		defer uart.Close()
+
+		// module output, escaped
+		go func() {
+			buf := make([]byte, 256)
+			for {
+				n, err := uart.Read(buf)
+				if err != nil {
+					return
+				}
+				conn.Write(escapeIAC(buf[:n]))
+			}
+		}()
+
+		// client input, telnet commands removed
+		buf := make([]byte, 256)
+		var sb []byte
+		state := telnetStateData
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			var data []byte
+			for _, b := range buf[:n] {
+				switch state {
+				case telnetStateData:
+					if b == telnetIAC {
+						state = telnetStateIAC
+					} else {
+						data = append(data, b)
+					}
+				case telnetStateIAC:
+					switch b {
+					case telnetIAC:
+						data = append(data, b)
+						state = telnetStateData
+					case telnetSB:
+						sb = sb[:0]
+						state = telnetStateSB
+					case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+						state = telnetStateOption
+					default:
+						state = telnetStateData
+					}
+				case telnetStateOption:
+					state = telnetStateData
+				case telnetStateSB:
+					if b == telnetIAC {
+						state = telnetStateSBIAC
+					} else {
+						sb = append(sb, b)
+					}
+				case telnetStateSBIAC:
+					state = telnetStateData
+					if len(sb) >= 2 && sb[0] == telnetOptComPort {
+						if sb[1] == comPortSetBaudRate && len(sb) == 6 {
+							uart.SetBaudRate(int(binary.BigEndian.Uint32(sb[2:])))
+						}
+						ack := append([]byte{telnetIAC, telnetSB, telnetOptComPort, sb[1] + comPortServerOffset}, sb[2:]...)
+						conn.Write(append(ack, telnetIAC, telnetSE))
+					}
+				}
+			}
+			uart.Write(data)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// TestDialTCP runs a connection over a raw TCP serial server
+func TestDialTCP(t *testing.T) {
+	module := emulator.New()
+	transport, err := DialTCP(serveRaw(t, module), 0)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	address := uint16(9)
+	lora, errEvent := CreateConnectionTransport(transport, Configuration{Address: &address}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to create connection: %v", errEvent.Err)
+	}
+	defer lora.CloseConnection()
+
+	if module.State().Address != address {
+		t.Fatalf("address not applied")
+	}
+}
+
+// TestDialRFC2217 checks that an IPR change is followed by the remote UART
+func TestDialRFC2217(t *testing.T) {
+	module := emulator.New()
+	transport, err := DialRFC2217(serveRFC2217(t, module), UartBaudRate_115200, 0)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	// the RF power is set after IPR, so it only arrives if the remote UART followed
+	baudRate := UartBaudRate_9600
+	rfPower := uint8(3)
+	lora, errEvent := CreateConnectionTransport(transport, Configuration{UartBaudRate: &baudRate, RFOutputPower: &rfPower}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to create connection: %v", errEvent.Err)
+	}
+	defer lora.CloseConnection()
+
+	if sendErr := lora.SendMessage(2, []byte{'a', 0xff, 'b'}); sendErr != nil {
+		t.Fatalf("Failed to send: %v", sendErr.Err)
+	}
+
+	state := module.State()
+	if state.BaudRate != baudRate || state.RFOutputPower != rfPower {
+		t.Fatalf("unexpected module state %+v", state)
+	}
+	sent := module.Sent()
+	if len(sent) != 1 || string(sent[0].Data) != "a\xffb" {
+		t.Fatalf("unexpected frames %+v", sent)
+	}
+}
+
+// TestDialRFC2217BaudRate checks that the dialled rate is known to the connection, so a failed IPR
+// change can be rolled back to it
+func TestDialRFC2217BaudRate(t *testing.T) {
+	module := emulator.New()
+	transport, err := DialRFC2217(serveRFC2217(t, module), UartBaudRate_115200, 0)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	lora, errEvent := CreateConnectionTransport(transport, Configuration{}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to create connection: %v", errEvent.Err)
+	}
+	defer lora.CloseConnection()
+
+	if lora.BaudRate() != UartBaudRate_115200 {
+		t.Fatalf("host at %d, want %d", lora.BaudRate(), UartBaudRate_115200)
+	}
+}
+
+// TestDialTCPBaudRateChange checks that an IPR change a raw bridge cannot follow is reported
+func TestDialTCPBaudRateChange(t *testing.T) {
+	module := emulator.New()
+	transport, err := DialTCP(serveRaw(t, module), 0)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	lora, errEvent := CreateConnectionTransport(transport, Configuration{}, 10)
+	if errEvent != nil {
+		t.Fatalf("Failed to create connection: %v", errEvent.Err)
+	}
+	defer lora.CloseConnection()
+
+	baudRate := UartBaudRate_9600
+	errEvent = lora.SetConfig(Configuration{UartBaudRate: &baudRate})
+	if errEvent == nil || !strings.Contains(errEvent.Err.Error(), "not reachable at 9600") {
+		t.Fatalf("expected an unreachable error, got %+v", errEvent)
+	}
+	if lora.appliedConfig().UartBaudRate != nil {
+		t.Fatal("IPR recorded as applied")
+	}
+}
@@ -0,0 +1,220 @@
+package krylr896
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeTimeout is how long a probe waits for the module to answer at one baud rate
+const probeTimeout = 300 * time.Millisecond
+
+// portLine is a line or +RCV frame read from the port, or the bytes the tokenizer discarded in its place
+type portLine struct {
+	text      string
+	malformed *FrameParseError // set instead of text for discarded bytes
+}
+
+// portReader reads lines and +RCV frames from a transport in the background, discarded bytes are
+// reported on the same channel so everything stays in the order it arrived
+type portReader struct {
+	lines  chan portLine
+	errors chan error
+
+	done chan struct{} // closed by stop
+	wg   sync.WaitGroup
+}
+
+// startPortReader starts reading from r, the goroutines exit when r returns an error or on stop
+func startPortReader(r io.Reader, debugLog func(format string, args ...interface{})) *portReader {
+	reader := &portReader{
+		lines:  make(chan portLine, 10),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+
+	chunks := make(chan []byte)
+	readErr := make(chan error, 1)
+	reader.wg.Add(2)
+	go func() {
+		defer reader.wg.Done()
+		buf := make([]byte, 256)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buf[:n]...):
+				case <-reader.done:
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer reader.wg.Done()
+		var tk tokenizer
+		var gap <-chan time.Time // set while a frame is incomplete
+		for {
+			var parseErr *FrameParseError
+			select {
+			case chunk := <-chunks:
+				tk.push(chunk)
+			case <-gap:
+				parseErr = tk.flush()
+			case err := <-readErr:
+				reader.errors <- err
+				return
+			case <-reader.done:
+				return
+			}
+
+			for {
+				if parseErr != nil {
+					debugLog("RX discarded: %v", parseErr)
+					select {
+					case reader.lines <- portLine{malformed: parseErr}:
+					case <-reader.done:
+						return
+					}
+				}
+				token, nextErr, ok := tk.next()
+				if !ok {
+					break
+				}
+				parseErr = nextErr
+				if token != "" {
+					debugLog("RX: %q", token)
+					select {
+					case reader.lines <- portLine{text: token}:
+					case <-reader.done:
+						return
+					}
+				}
+			}
+
+			gap = nil
+			if tk.pending() {
+				gap = time.After(frameGapTimeout)
+			}
+		}
+	}()
+
+	return reader
+}
+
+// stop ends the reader, the transport must be closed first so that a pending read returns
+func (reader *portReader) stop() {
+	close(reader.done)
+	reader.wg.Wait()
+}
+
+// drain discards lines that are already waiting
+func (reader *portReader) drain() {
+	for {
+		select {
+		case <-reader.lines:
+		default:
+			return
+		}
+	}
+}
+
+// probeCommand writes cmd directly to the transport and waits for its answer, lines that cannot be
+// the answer (e.g. +RCV=) and discarded bytes are passed to unsolicited, or skipped when it is nil, this
+// must only be used while the command loop is not reading, i.e. before it starts or from inside it
+func probeCommand(t Transport, reader *portReader, cmd string, timeout time.Duration, unsolicited func(portLine)) (string, error) {
+	if _, err := t.Write([]byte(cmd + "\r\n")); err != nil {
+		return "", err
+	}
+
+	name := commandName(cmd)
+	deadline := time.After(timeout)
+	for {
+		select {
+		case l := <-reader.lines:
+			if l.malformed != nil {
+				if unsolicited != nil {
+					unsolicited(l)
+				}
+				continue
+			}
+			line := strings.TrimSuffix(strings.TrimSuffix(l.text, "\n"), "\r")
+			if line == "+OK" || line == "+"+name || strings.HasPrefix(line, "+"+name+"=") {
+				return line, nil
+			}
+			if errCodeStr, found := strings.CutPrefix(line, "+ERR="); found {
+				return line, fmt.Errorf("%s failed with code %s", cmd, errCodeStr)
+			}
+			if unsolicited != nil {
+				unsolicited(l)
+			}
+
+		case err := <-reader.errors:
+			reader.errors <- err
+			return "", err
+
+		case <-deadline:
+			return "", fmt.Errorf("no answer to %s within %v", cmd, timeout)
+		}
+	}
+}
+
+// commandName returns the name of an AT command, e.g. "VER" for "AT+VER?"
+func commandName(cmd string) string {
+	name, _ := strings.CutPrefix(cmd, "AT+")
+	if idx := strings.IndexAny(name, "=?"); idx != -1 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// probeBaudRate finds the rate the module answers "AT" at, trying each of baudRates in turn, the
+// transport must already be at baudRates[0]
+func probeBaudRate(t Transport, reader *portReader, baudRates []int) (int, error) {
+	for i, baudRate := range baudRates {
+		if i > 0 {
+			if err := setTransportBaudRate(t, baudRate); err != nil {
+				return 0, err
+			}
+		}
+		// noise left in the module's input can turn the first attempt into an error answer, so an
+		// answered attempt is retried once, silence means the rate is wrong
+		for attempt := 0; attempt < 2; attempt++ {
+			reader.drain()
+			line, err := probeCommand(t, reader, "AT", probeTimeout, nil)
+			if err == nil {
+				return baudRate, nil
+			}
+			select {
+			case err := <-reader.errors:
+				reader.errors <- err
+				return 0, err
+			default:
+			}
+			if line == "" {
+				break
+			}
+		}
+	}
+	return 0, fmt.Errorf("no answer at any of %v baud", baudRates)
+}
+
+// queryValue sends a query such as AT+VER? and returns the value after "="
+func queryValue(t Transport, reader *portReader, cmd string) (string, error) {
+	line, err := probeCommand(t, reader, cmd, probeTimeout, nil)
+	if err != nil {
+		return "", err
+	}
+	_, value, found := strings.Cut(line, "=")
+	if !found {
+		return "", fmt.Errorf("unexpected answer to %s: %q", cmd, line)
+	}
+	return value, nil
+}
@@ -0,0 +1,182 @@
+package krylr896
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priority orders queued commands, higher priorities are sent first and equal ones in arrival order
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0 // default for commands and raw Commands
+	PriorityHigh   Priority = 1
+)
+
+// priorities in the order they are served
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ErrExpired is returned for a command whose deadline passed before it was sent
+var ErrExpired = errors.New("command expired before it was sent")
+
+// clamp maps any value onto one of the priority classes
+func (p Priority) clamp() Priority {
+	switch {
+	case p > PriorityNormal:
+		return PriorityHigh
+	case p < PriorityNormal:
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// String names the priority
+func (p Priority) String() string {
+	switch p.clamp() {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	}
+	return "normal"
+}
+
+// queuedCommand is a command waiting to be sent
+type queuedCommand struct {
+	cmd   Command
+	timer *time.Timer // fires at the command's deadline, nil without one
+}
+
+// commandQueue holds commands waiting for the command loop
+type commandQueue struct {
+	ready chan struct{} // signalled when a command is pushed
+
+	shutdown <-chan struct{} // closed with the connection, see respond
+
+	mu      sync.Mutex
+	classes map[Priority][]*queuedCommand
+	closed  bool
+}
+
+// newCommandQueue returns an empty queue for a connection whose Close closes shutdown
+func newCommandQueue(shutdown <-chan struct{}) *commandQueue {
+	return &commandQueue{
+		ready:    make(chan struct{}, 1),
+		shutdown: shutdown,
+		classes:  make(map[Priority][]*queuedCommand),
+	}
+}
+
+// push queues a command behind others of its priority, it fails with ErrClosed once the queue is closed
+func (q *commandQueue) push(cmd Command) {
+	item := &queuedCommand{cmd: cmd}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		respond(cmd, closedResponse(), q.shutdown)
+		return
+	}
+	priority := cmd.Priority.clamp()
+	q.classes[priority] = append(q.classes[priority], item)
+	if !cmd.Deadline.IsZero() {
+		item.timer = time.AfterFunc(time.Until(cmd.Deadline), func() { q.expire(item) })
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// close fails every queued command and any pushed later with ErrClosed
+func (q *commandQueue) close() {
+	q.mu.Lock()
+	var items []*queuedCommand
+	for _, priority := range priorities {
+		items = append(items, q.classes[priority]...)
+		delete(q.classes, priority)
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	for _, item := range items {
+		if item.timer != nil {
+			item.timer.Stop()
+		}
+		respond(item.cmd, closedResponse(), q.shutdown)
+	}
+}
+
+// pop removes the next command to send, ok is false if the queue is empty
+func (q *commandQueue) pop() (cmd Command, ok bool) {
+	for {
+		q.mu.Lock()
+		var item *queuedCommand
+		for _, priority := range priorities {
+			if class := q.classes[priority]; len(class) > 0 {
+				item = class[0]
+				q.classes[priority] = class[1:]
+				break
+			}
+		}
+		q.mu.Unlock()
+
+		if item == nil {
+			return Command{}, false
+		}
+		if item.timer != nil {
+			item.timer.Stop()
+			// the timer may not have run yet for a deadline that has just passed
+			if time.Now().After(item.cmd.Deadline) {
+				q.respondExpired(item.cmd)
+				continue
+			}
+		}
+		return item.cmd, true
+	}
+}
+
+// expire drops a command still queued at its deadline
+func (q *commandQueue) expire(item *queuedCommand) {
+	q.mu.Lock()
+	priority := item.cmd.Priority.clamp()
+	found := false
+	for i, queued := range q.classes[priority] {
+		if queued == item {
+			q.classes[priority] = append(q.classes[priority][:i:i], q.classes[priority][i+1:]...)
+			found = true
+			break
+		}
+	}
+	q.mu.Unlock()
+
+	if found {
+		q.respondExpired(item.cmd)
+	}
+}
+
+// respondExpired tells the sender of an expired command
+func (q *commandQueue) respondExpired(cmd Command) {
+	respond(cmd, CommandResponse{Error: &ErrorEvent{Code: nil, Err: ErrExpired}}, q.shutdown)
+}
+
+// depth returns the number of queued commands per priority
+func (q *commandQueue) depth() map[Priority]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depth := make(map[Priority]int, len(priorities))
+	for _, priority := range priorities {
+		depth[priority] = len(q.classes[priority])
+	}
+	return depth
+}
+
+// QueueDepth returns how many commands are waiting to be sent at each priority
+func (Lora *lora) QueueDepth() map[Priority]int {
+	return Lora.queue.depth()
+}
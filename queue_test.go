@@ -0,0 +1,92 @@
+package krylr896
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n commands are queued
+func waitQueued(t *testing.T, lora *lora, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		total := 0
+		for _, depth := range lora.QueueDepth() {
+			total += depth
+		}
+		if total == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %d queued commands, have %d", n, total)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestQueuePriority checks that queued messages are sent highest priority first
+func TestQueuePriority(t *testing.T) {
+	// hold the first answer back so the other messages queue up behind it
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultDelayLine, Match: "+OK", Nth: 1, Delay: 100 * time.Millisecond})
+
+	done := make(chan *ErrorEvent, 4)
+	send := func(data string, priority Priority) {
+		go func() {
+			done <- lora.SendMessageWithOptions(context.Background(), 2, []byte(data), SendOptions{Priority: priority})
+		}()
+	}
+	send("first", PriorityLow)
+	time.Sleep(10 * time.Millisecond)
+	send("low", PriorityLow)
+	waitQueued(t, lora, 1)
+	send("normal", PriorityNormal)
+	waitQueued(t, lora, 2)
+	send("high", PriorityHigh)
+	waitQueued(t, lora, 3)
+
+	if depth := lora.QueueDepth(); depth[PriorityHigh] != 1 || depth[PriorityNormal] != 1 || depth[PriorityLow] != 1 {
+		t.Fatalf("unexpected queue depth: %v", depth)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("send failed: %v", err.Err)
+		}
+	}
+
+	want := []string{"first", "high", "normal", "low"}
+	sent := module.Sent()
+	for i, frame := range sent {
+		if i >= len(want) || string(frame.Data) != want[i] {
+			t.Fatalf("sent in the wrong order: %+v", sent)
+		}
+	}
+}
+
+// TestQueueDeadline checks that a message still queued at its deadline is dropped
+func TestQueueDeadline(t *testing.T) {
+	lora, module, _ := faultConnection(t, FaultRule{Kind: FaultDelayLine, Match: "+OK", Nth: 1, Delay: 200 * time.Millisecond})
+
+	go lora.SendMessage(2, []byte("slow"))
+	time.Sleep(10 * time.Millisecond)
+
+	start := time.Now()
+	err := lora.SendMessageWithOptions(context.Background(), 2, []byte("late"),
+		SendOptions{Deadline: time.Now().Add(50 * time.Millisecond)})
+	if err == nil || !errors.Is(err.Err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("expiry took %v", elapsed)
+	}
+
+	if _, err := lora.SendCommand("AT"); err != nil {
+		t.Fatalf("command after expiry failed: %v", err.Err)
+	}
+	for _, frame := range module.Sent() {
+		if string(frame.Data) == "late" {
+			t.Fatal("expired message was sent")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package krylr896
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConfigChange is a field Reconcile found different on the module and set
+type ConfigChange struct {
+	Field string // query name, e.g. "BAND"
+	From  string // value read from the module, written as in the AT command
+	To    string // value applied
+}
+
+// ReconcileReport describes what a Reconcile pass did
+type ReconcileReport struct {
+	Changes   []ConfigChange // fields that were set, in the order they were sent
+	Unchanged []string       // fields already at the desired value
+}
+
+// ReconcileResult is a periodic Reconcile pass that changed something or failed
+type ReconcileResult struct {
+	Time   time.Time
+	Report ReconcileReport
+	Error  *ErrorEvent
+}
+
+// reconcileOrder is the order fields are applied in, IPR goes last so a failed baud switch leaves every
+// other field set
+var reconcileOrder = []string{"ADDRESS", "NETWORKID", "BAND", "PARAMETER", "MODE", "CPIN", "CRFOP", "IPR"}
+
+// configDiff returns the fields of desired that are set and hold another value in actual, in reconcileOrder
+func configDiff(actual Configuration, desired Configuration) (changed []string, unchanged []string) {
+	for _, field := range reconcileOrder {
+		want := configValue(desired, field)
+		if want == "" {
+			continue
+		}
+		if configValue(actual, field) == want {
+			unchanged = append(unchanged, field)
+		} else {
+			changed = append(changed, field)
+		}
+	}
+	return changed, unchanged
+}
+
+// Reconcile reads the module's configuration and sets only the fields of desired that differ, nil fields
+// are ignored. The result is read back to verify it
+func (Lora *lora) Reconcile(desired Configuration) (ReconcileReport, *ErrorEvent) {
+	return Lora.ReconcileContext(context.Background(), desired)
+}
+
+// ReconcileContext is Reconcile, stopping at the next command when ctx ends
+func (Lora *lora) ReconcileContext(ctx context.Context, desired Configuration) (ReconcileReport, *ErrorEvent) {
+	var report ReconcileReport
+	if err := desired.ValidateFor(Lora.Capabilities()); err != nil {
+		return report, &ErrorEvent{Code: nil, Err: err}
+	}
+
+	actual, err := Lora.GetConfigContext(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	changed, unchanged := configDiff(actual, desired)
+	report.Unchanged = unchanged
+	for _, field := range changed {
+		single, _ := configField(desired, field)
+		if err := Lora.SetConfigContext(ctx, single); err != nil {
+			return report, err
+		}
+		report.Changes = append(report.Changes, ConfigChange{
+			Field: field,
+			From:  configValue(actual, field),
+			To:    configValue(desired, field),
+		})
+	}
+
+	// unchanged fields count as applied too, so a reconnect restores them
+	Lora.recordApplied(desired)
+	if len(changed) == 0 {
+		return report, nil
+	}
+
+	// read back to verify
+	actual, err = Lora.GetConfigContext(ctx)
+	if err != nil {
+		if err.Err != nil {
+			return report, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to verify configuration: %w", err.Err)}
+		}
+		return report, &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to verify configuration")}
+	}
+	if differ, _ := configDiff(actual, desired); len(differ) != 0 {
+		return report, &ErrorEvent{Code: nil, Err: fmt.Errorf("configuration not verified, %s still differ", strings.Join(differ, ", "))}
+	}
+	return report, nil
+}
+
+// ReconcileEvery runs Reconcile straight away and then every interval until ctx ends or the connection
+// is closed, correcting drift. Passes that changed a field or failed are sent on the returned channel,
+// which is closed when it stops
+func (Lora *lora) ReconcileEvery(ctx context.Context, desired Configuration, interval time.Duration) <-chan ReconcileResult {
+	var config Configuration
+	mergeConfig(&config, desired)
+	results := make(chan ReconcileResult, 1)
+
+	go func() {
+		defer close(results)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := Lora.ReconcileContext(ctx, config)
+			if ctx.Err() != nil {
+				// a pass cut short by ctx is not reported
+				return
+			}
+			if len(report.Changes) != 0 || err != nil {
+				select {
+				case results <- ReconcileResult{Time: time.Now(), Report: report, Error: err}:
+				case <-ctx.Done():
+					return
+				case <-Lora.closed:
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			case <-Lora.closed:
+				return
+			}
+		}
+	}()
+	return results
+}
@@ -0,0 +1,143 @@
+package krylr896
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// setLog records the AT commands that change a setting
+type setLog struct {
+	*emulator.Conn
+	mu   *sync.Mutex
+	sets *[]string
+}
+
+// Write records commands that set a value before passing them on
+func (l setLog) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+	if strings.Contains(line, "=") {
+		l.mu.Lock()
+		*l.sets = append(*l.sets, line)
+		l.mu.Unlock()
+	}
+	return l.Conn.Write(p)
+}
+
+// take returns the commands recorded so far and clears the log
+func (l setLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sets := *l.sets
+	*l.sets = nil
+	return sets
+}
+
+// TestReconcile checks that only differing fields are sent and that a second pass sends nothing
+func TestReconcile(t *testing.T) {
+	module := emulator.New()
+	log := setLog{Conn: module.Attach(), mu: &sync.Mutex{}, sets: new([]string)}
+	lora, err := CreateConnectionTransport(log, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+	log.take()
+
+	address := uint16(0)
+	networkID := uint8(6)
+	band := BandINDIA
+	baudRate := UartBaudRate_57600
+	rfPower := uint8(15)
+	desired := Configuration{Address: &address, NetworkID: &networkID, Band: &band, UartBaudRate: &baudRate, RFOutputPower: &rfPower}
+
+	report, err := lora.Reconcile(desired)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err.Err)
+	}
+	want := []ConfigChange{
+		{Field: "NETWORKID", From: "0", To: "6"},
+		{Field: "BAND", From: "915000000", To: "865000000"},
+		{Field: "IPR", From: "115200", To: "57600"},
+	}
+	if !reflect.DeepEqual(report.Changes, want) {
+		t.Fatalf("unexpected changes %+v", report.Changes)
+	}
+	if !reflect.DeepEqual(report.Unchanged, []string{"ADDRESS", "CRFOP"}) {
+		t.Fatalf("unexpected unchanged fields %v", report.Unchanged)
+	}
+	sets := log.take()
+	if !reflect.DeepEqual(sets, []string{"AT+NETWORKID=6", "AT+BAND=865000000", "AT+IPR=57600"}) {
+		t.Fatalf("unexpected commands %v", sets)
+	}
+	if lora.BaudRate() != baudRate {
+		t.Fatalf("host at %d, want %d", lora.BaudRate(), baudRate)
+	}
+
+	report, err = lora.Reconcile(desired)
+	if err != nil {
+		t.Fatalf("second Reconcile failed: %v", err.Err)
+	}
+	if len(report.Changes) != 0 || len(report.Unchanged) != 5 {
+		t.Fatalf("second pass not idempotent: %+v", report)
+	}
+	if sets := log.take(); len(sets) != 0 {
+		t.Fatalf("second pass sent %v", sets)
+	}
+}
+
+// TestReconcileEvery checks that drift is corrected on the next pass
+func TestReconcileEvery(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	networkID := uint8(9)
+	ctx, cancel := context.WithCancel(context.Background())
+	results := lora.ReconcileEvery(ctx, Configuration{NetworkID: &networkID}, 20*time.Millisecond)
+
+	next := func() ReconcileResult {
+		t.Helper()
+		select {
+		case result := <-results:
+			if result.Error != nil {
+				t.Fatalf("pass failed: %v", result.Error.Err)
+			}
+			return result
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for a reconcile pass")
+		}
+		return ReconcileResult{}
+	}
+
+	if result := next(); len(result.Report.Changes) != 1 || module.State().NetworkID != networkID {
+		t.Fatalf("initial pass did not apply: %+v", result.Report)
+	}
+
+	// something else changes the network ID behind the reconciler's back
+	if _, err := lora.SendCommand("AT+NETWORKID=3"); err != nil {
+		t.Fatalf("drift failed: %v", err.Err)
+	}
+	result := next()
+	if len(result.Report.Changes) != 1 || result.Report.Changes[0] != (ConfigChange{Field: "NETWORKID", From: "3", To: "9"}) {
+		t.Fatalf("drift not corrected: %+v", result.Report)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Fatal("unexpected result after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("results not closed after cancel")
+	}
+}
@@ -0,0 +1,151 @@
+package krylr896
+
+import (
+	"fmt"
+	"time"
+)
+
+// reconnect defaults
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// ReconnectOptions enables reopening the link after the port fails
+type ReconnectOptions struct {
+	Dial           func(baudRate int) (Transport, error) // reopens the link at the host's current baud rate, the serial port and UID constructors fill this in
+	InitialBackoff time.Duration                         // wait before the first attempt, doubled after each failure, 500ms when zero
+	MaxBackoff     time.Duration                         // longest wait between attempts, 30s when zero
+	MaxAttempts    int                                   // give up after this many failed attempts, 0 to keep trying
+}
+
+// LinkState is the state reported by a LinkEvent
+type LinkState int
+
+const (
+	LinkConnected    LinkState = iota // the connection was created
+	LinkLost                          // the port failed, Err holds the cause
+	LinkReconnecting                  // attempt number Attempt is about to start, Err holds why the previous one failed
+	LinkRestored                      // the link is back and the configuration has been reapplied
+	LinkFailed                        // reconnection gave up and the connection is dead, or the watchdog ran out of steps without Reconnect
+	LinkUnresponsive                  // a watchdog probe or a command timed out, Attempt counts consecutive failures
+	LinkSoftReset                     // the watchdog sent AT+RESET
+	LinkHardReset                     // the watchdog pulsed the reset pin through RTS
+)
+
+// String names the link state
+func (s LinkState) String() string {
+	names := []string{"connected", "lost", "reconnecting", "restored", "failed", "unresponsive", "soft-reset", "hard-reset"}
+	if int(s) < len(names) {
+		return names[s]
+	}
+	return fmt.Sprintf("LinkState(%d)", int(s))
+}
+
+// LinkEvent reports a change in the state of the link to the module
+type LinkEvent struct {
+	State   LinkState
+	Attempt int   // reconnection attempt, 0 when not reconnecting
+	Err     error // cause, nil if not applicable
+	Time    time.Time
+}
+
+// emitLink sends a link event, dropping it if nobody is reading
+func (Lora *lora) emitLink(event LinkEvent) {
+	event.Time = time.Now()
+	Lora.debugLog("Link %v, attempt %d, err %v", event.State, event.Attempt, event.Err)
+	select {
+	case Lora.LinkEvents <- event:
+	default:
+		// channel is full, drop event
+		Lora.debugLog("LinkEvents channel full, dropping event")
+	}
+}
+
+// reconnectLink reopens the link after the port failed with cause, it runs inside the command loop and
+// reports false when the connection was closed or reconnection gave up
+func (Lora *lora) reconnectLink(cause error) bool {
+	opts := Lora.reconnect
+	backoff := opts.InitialBackoff
+	if backoff == 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	lastErr := cause
+	for attempt := 1; opts.MaxAttempts == 0 || attempt <= opts.MaxAttempts; attempt++ {
+		Lora.emitLink(LinkEvent{State: LinkReconnecting, Attempt: attempt, Err: lastErr})
+		select {
+		case <-time.After(backoff):
+		case <-Lora.closed:
+			return false
+		}
+
+		lastErr = Lora.reopen()
+		if lastErr == nil {
+			Lora.emitLink(LinkEvent{State: LinkRestored, Attempt: attempt})
+			return true
+		}
+		if lastErr == ErrClosed {
+			return false
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+
+	Lora.emitLink(LinkEvent{State: LinkFailed, Err: lastErr})
+	return false
+}
+
+// reopen dials the link, checks the module answers and reapplies the configuration
+func (Lora *lora) reopen() error {
+	transport, err := Lora.reconnect.Dial(Lora.BaudRate())
+	if err != nil {
+		return err
+	}
+
+	// swap the transport unless Close has started, Close then shuts down whichever one is installed
+	Lora.mu.Lock()
+	select {
+	case <-Lora.closed:
+		Lora.mu.Unlock()
+		transport.Close()
+		return ErrClosed
+	default:
+	}
+	oldPort, oldReader := Lora.port, Lora.reader
+	Lora.port = transport
+	Lora.reader = startPortReader(transport, Lora.debugLog)
+	Lora.mu.Unlock()
+
+	oldPort.Close()
+	oldReader.stop()
+
+	if _, err := probeBaudRate(Lora.port, Lora.reader, []int{Lora.BaudRate()}); err != nil {
+		transport.Close()
+		return fmt.Errorf("module not answering after reconnect: %w", err)
+	}
+
+	if err := Lora.reapplyConfig(); err != nil {
+		transport.Close()
+		return err
+	}
+	return nil
+}
+
+// reapplyConfig sends every setting the module has accepted again, it runs inside the command loop
+func (Lora *lora) reapplyConfig() error {
+	unsolicited := Lora.handleUnsolicited
+	for _, cmd := range configCommands(Lora.appliedConfig()) {
+		// the host is already at the module's rate
+		if commandName(cmd) == "IPR" {
+			continue
+		}
+		if _, err := probeCommand(Lora.port, Lora.reader, cmd, Lora.commandTimeout(cmd), unsolicited); err != nil {
+			return fmt.Errorf("failed to reapply configuration: %w", err)
+		}
+	}
+	return nil
+}
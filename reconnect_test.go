@@ -0,0 +1,123 @@
+package krylr896
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// nextLinkEvent waits for an event on the LinkEvents channel
+func nextLinkEvent(t *testing.T, lora *lora) LinkEvent {
+	t.Helper()
+	select {
+	case event := <-lora.LinkEvents:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for a link event")
+	}
+	return LinkEvent{}
+}
+
+// TestReconnect unplugs an emulated module, resets it while it is away and checks that the link comes
+// back with the configuration reapplied and the queued message sent
+func TestReconnect(t *testing.T) {
+	module := emulator.New()
+	conn := module.Attach()
+
+	replugged := make(chan struct{})
+	dial := func(baudRate int) (Transport, error) {
+		select {
+		case <-replugged:
+			return module.Attach(), nil
+		default:
+			return nil, errors.New("no such device")
+		}
+	}
+
+	address := uint16(7)
+	lora, err := CreateConnectionTransportWithOptions(conn, 0, Configuration{Address: &address}, 10,
+		ConnectionOptions{Reconnect: &ReconnectOptions{Dial: dial, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.Close()
+
+	if event := nextLinkEvent(t, lora); event.State != LinkConnected {
+		t.Fatalf("expected connected, got %v", event.State)
+	}
+
+	conn.Unplug()
+	if event := nextLinkEvent(t, lora); event.State != LinkLost || !errors.Is(event.Err, emulator.ErrUnplugged) {
+		t.Fatalf("expected lost, got %+v", event)
+	}
+	ticket := lora.SendAsync(2, []byte("queued"), SendOptions{})
+
+	// the module loses its settings while unplugged
+	other := module.Attach()
+	other.Write([]byte("AT+FACTORY\r\n"))
+	other.Close()
+	if module.State().Address != 0 {
+		t.Fatal("module not reset")
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if event := nextLinkEvent(t, lora); event.State != LinkReconnecting || event.Attempt != attempt {
+			t.Fatalf("expected attempt %d, got %+v", attempt, event)
+		}
+	}
+	close(replugged)
+	for {
+		event := nextLinkEvent(t, lora)
+		if event.State == LinkRestored {
+			break
+		}
+		if event.State != LinkReconnecting {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+
+	if module.State().Address != address {
+		t.Fatalf("address %d not reapplied", address)
+	}
+	select {
+	case <-ticket.Done():
+		if report := ticket.Report(); report.Error != nil {
+			t.Fatalf("queued message failed: %v", report.Error.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued message not sent after reconnect")
+	}
+	if _, err := lora.SendCommand("AT"); err != nil {
+		t.Fatalf("command after reconnect failed: %v", err.Err)
+	}
+}
+
+// TestReconnectGivesUp checks that a connection reports failure after the last attempt
+func TestReconnectGivesUp(t *testing.T) {
+	module := emulator.New()
+	conn := module.Attach()
+	dial := func(int) (Transport, error) { return nil, errors.New("no such device") }
+
+	lora, err := CreateConnectionTransportWithOptions(conn, 0, Configuration{}, 10,
+		ConnectionOptions{Reconnect: &ReconnectOptions{Dial: dial, InitialBackoff: time.Millisecond, MaxAttempts: 2}})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.Close()
+
+	conn.Unplug()
+	var states []LinkState
+	for len(states) == 0 || states[len(states)-1] != LinkFailed {
+		states = append(states, nextLinkEvent(t, lora).State)
+	}
+	want := []LinkState{LinkConnected, LinkLost, LinkReconnecting, LinkReconnecting, LinkFailed}
+	if len(states) != len(want) {
+		t.Fatalf("got states %v, want %v", states, want)
+	}
+
+	if _, err := lora.SendCommand("AT"); err == nil || !errors.Is(err.Err, ErrClosed) {
+		t.Fatalf("expected ErrClosed once reconnection gave up, got %+v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package krylr896
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is which way a recorded line travelled
+type Direction string
+
+const (
+	DirectionTX Direction = "TX" // written by the library to the module
+	DirectionRX Direction = "RX" // read by the library from the module
+)
+
+// SessionEvent is one line of a recorded session, Data includes the line ending
+type SessionEvent struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+// String formats the event as a session file line: <RFC3339Nano time> <TX|RX> <quoted data>
+func (e SessionEvent) String() string {
+	return fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339Nano), e.Direction, strconv.Quote(string(e.Data)))
+}
+
+// ParseSessionEvent parses a line produced by SessionEvent.String
+func ParseSessionEvent(line string) (SessionEvent, error) {
+	var event SessionEvent
+
+	timeStr, rest, found := strings.Cut(line, " ")
+	if !found {
+		return event, fmt.Errorf("malformed session line: %q", line)
+	}
+	dirStr, quoted, found := strings.Cut(rest, " ")
+	if !found {
+		return event, fmt.Errorf("malformed session line: %q", line)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, timeStr)
+	if err != nil {
+		return event, fmt.Errorf("malformed session time: %w", err)
+	}
+	event.Time = t
+
+	switch Direction(dirStr) {
+	case DirectionTX, DirectionRX:
+		event.Direction = Direction(dirStr)
+	default:
+		return event, fmt.Errorf("unknown session direction %q", dirStr)
+	}
+
+	data, err := strconv.Unquote(quoted)
+	if err != nil {
+		return event, fmt.Errorf("malformed session data: %w", err)
+	}
+	event.Data = []byte(data)
+
+	return event, nil
+}
+
+// ReadSession parses a recorded session, blank lines are skipped
+func ReadSession(r io.Reader) ([]SessionEvent, error) {
+	var events []SessionEvent
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		event, err := ParseSessionEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// recordingTransport copies every line crossing a transport to a session writer
+type recordingTransport struct {
+	inner Transport
+	mu    sync.Mutex
+	w     io.Writer
+	rxBuf []byte // partial received line
+}
+
+// NewRecordingTransport wraps a transport so that every written command and received line is
+// appended to w in the session format, with its timestamp and direction
+func NewRecordingTransport(inner Transport, w io.Writer) Transport {
+	return &recordingTransport{inner: inner, w: w}
+}
+
+// record writes one event, caller holds t.mu
+func (t *recordingTransport) record(direction Direction, data []byte) {
+	event := SessionEvent{Time: time.Now(), Direction: direction, Data: data}
+	fmt.Fprintln(t.w, event.String())
+}
+
+// Read reads from the inner transport, recording each complete line
+func (t *recordingTransport) Read(p []byte) (int, error) {
+	n, err := t.inner.Read(p)
+
+	t.mu.Lock()
+	t.rxBuf = append(t.rxBuf, p[:n]...)
+	for {
+		idx := bytes.IndexByte(t.rxBuf, '\n')
+		if idx == -1 {
+			break
+		}
+		t.record(DirectionRX, append([]byte(nil), t.rxBuf[:idx+1]...))
+		t.rxBuf = t.rxBuf[idx+1:]
+	}
+	t.mu.Unlock()
+
+	return n, err
+}
+
+// Write records the written bytes and passes them to the inner transport
+func (t *recordingTransport) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.record(DirectionTX, append([]byte(nil), p...))
+	t.mu.Unlock()
+
+	return t.inner.Write(p)
+}
+
+// Close records any partial line and closes the inner transport
+func (t *recordingTransport) Close() error {
+	t.mu.Lock()
+	if len(t.rxBuf) > 0 {
+		t.record(DirectionRX, t.rxBuf)
+		t.rxBuf = nil
+	}
+	t.mu.Unlock()
+
+	return t.inner.Close()
+}
+
+// SetBaudRate passes through to the inner transport
+func (t *recordingTransport) SetBaudRate(baudRate int) error {
+	return setTransportBaudRate(t.inner, baudRate)
+}
+
+// SetDTR passes through to the inner transport
+func (t *recordingTransport) SetDTR(dtr bool) error {
+	return setTransportDTR(t.inner, dtr)
+}
+
+// SetRTS passes through to the inner transport
+func (t *recordingTransport) SetRTS(rts bool) error {
+	return setTransportRTS(t.inner, rts)
+}
+
+// ReplayMismatch is a command the library wrote that differs from the recording
+type ReplayMismatch struct {
+	Index    int    // index of the expected TX event, -1 if the recording had already ended
+	Expected []byte // recorded command, nil if none was expected
+	Got      []byte // command written during replay
+}
+
+// ReplayTransport feeds a recorded session back into the library, RX lines are delivered with their
+// original spacing relative to the preceding command and written commands are checked against the
+// recorded TX lines
+type ReplayTransport struct {
+	events []SessionEvent
+	speed  float64
+	writes chan []byte
+	closed chan struct{}
+	done   chan struct{}
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	out        []byte // replayed bytes waiting to be read
+	isClosed   bool
+	mismatches []ReplayMismatch
+	closeOnce  sync.Once
+}
+
+// NewReplayTransport replays events, speed 1 keeps the original timing, 10 plays ten times faster
+// and 0 or less delivers lines as soon as they are due in sequence
+func NewReplayTransport(events []SessionEvent, speed float64) *ReplayTransport {
+	t := &ReplayTransport{
+		events: events,
+		speed:  speed,
+		writes: make(chan []byte, len(events)+16),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	t.cond = sync.NewCond(&t.mu)
+	go t.play()
+	return t
+}
+
+// play walks the recording, waiting for commands and releasing responses
+func (t *ReplayTransport) play() {
+	defer close(t.done)
+
+	var anchorReal, anchorRecorded time.Time
+	if len(t.events) > 0 {
+		anchorReal, anchorRecorded = time.Now(), t.events[0].Time
+	}
+
+	for i, event := range t.events {
+		switch event.Direction {
+		case DirectionTX:
+			var got []byte
+			select {
+			case got = <-t.writes:
+			case <-t.closed:
+				return
+			}
+			if !bytes.Equal(got, event.Data) {
+				t.addMismatch(ReplayMismatch{Index: i, Expected: event.Data, Got: got})
+			}
+			anchorReal, anchorRecorded = time.Now(), event.Time
+
+		case DirectionRX:
+			if t.speed > 0 {
+				due := anchorReal.Add(time.Duration(float64(event.Time.Sub(anchorRecorded)) / t.speed))
+				if wait := time.Until(due); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-t.closed:
+						return
+					}
+				}
+			}
+			t.mu.Lock()
+			t.out = append(t.out, event.Data...)
+			t.cond.Broadcast()
+			t.mu.Unlock()
+		}
+	}
+}
+
+// addMismatch records a difference between the recording and the replay
+func (t *ReplayTransport) addMismatch(m ReplayMismatch) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mismatches = append(t.mismatches, m)
+}
+
+// Read returns replayed module output, blocking until some is due
+func (t *ReplayTransport) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(t.out) == 0 && !t.isClosed {
+		t.cond.Wait()
+	}
+	if len(t.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
+
+// Write hands a command to the replay for comparison
+func (t *ReplayTransport) Write(p []byte) (int, error) {
+	select {
+	case <-t.closed:
+		return 0, io.ErrClosedPipe
+	case <-t.done:
+		t.addMismatch(ReplayMismatch{Index: -1, Got: append([]byte(nil), p...)})
+		return len(p), nil
+	default:
+	}
+
+	select {
+	case t.writes <- append([]byte(nil), p...):
+	default:
+		t.addMismatch(ReplayMismatch{Index: -1, Got: append([]byte(nil), p...)})
+	}
+	return len(p), nil
+}
+
+// Close stops the replay
+func (t *ReplayTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.mu.Lock()
+		t.isClosed = true
+		t.cond.Broadcast()
+		t.mu.Unlock()
+	})
+	return nil
+}
+
+// Done is closed once every recorded event has been replayed
+func (t *ReplayTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Mismatches returns the commands that differed from the recording so far
+func (t *ReplayTransport) Mismatches() []ReplayMismatch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]ReplayMismatch(nil), t.mismatches...)
+}
+
+// Verify reports an error if the replay has not finished or any command differed
+func (t *ReplayTransport) Verify() error {
+	select {
+	case <-t.done:
+	default:
+		return fmt.Errorf("replay incomplete")
+	}
+
+	mismatches := t.Mismatches()
+	if len(mismatches) == 0 {
+		return nil
+	}
+	m := mismatches[0]
+	return fmt.Errorf("%d command(s) differ from the recording, first at event %d: expected %q, got %q",
+		len(mismatches), m.Index, m.Expected, m.Got)
+}
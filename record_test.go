@@ -0,0 +1,91 @@
+package krylr896
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// recordSession runs a short session against the emulator and returns the recording
+func recordSession(t *testing.T) []SessionEvent {
+	t.Helper()
+
+	var buf bytes.Buffer
+	address := uint16(7)
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(NewRecordingTransport(module.Attach(), &buf), Configuration{Address: &address}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	if sendErr := lora.SendMessage(2, []byte("a \"quoted\"\tline")); sendErr != nil {
+		t.Fatalf("Failed to send message: %v", sendErr.Err)
+	}
+	module.Inject(3, []byte("pong"), -40, 9)
+	<-lora.RecievedData
+	lora.CloseConnection()
+
+	events, readErr := ReadSession(strings.NewReader(buf.String()))
+	if readErr != nil {
+		t.Fatalf("ReadSession: %v", readErr)
+	}
+	return events
+}
+
+// TestRecordReplay records a session and replays it against an identical sequence of calls
+func TestRecordReplay(t *testing.T) {
+	events := recordSession(t)
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d: %v", len(events), events)
+	}
+	if events[0].Direction != DirectionTX || string(events[0].Data) != "AT+ADDRESS=7\r\n" {
+		t.Fatalf("unexpected first event %v", events[0])
+	}
+
+	replay := NewReplayTransport(events, 0)
+	address := uint16(7)
+	lora, err := CreateConnectionTransport(replay, Configuration{Address: &address}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	if sendErr := lora.SendMessage(2, []byte("a \"quoted\"\tline")); sendErr != nil {
+		t.Fatalf("Failed to send message: %v", sendErr.Err)
+	}
+	select {
+	case msg := <-lora.RecievedData:
+		if string(msg.Data[:msg.Length]) != "pong" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replayed message not received")
+	}
+
+	<-replay.Done()
+	if verifyErr := replay.Verify(); verifyErr != nil {
+		t.Fatal(verifyErr)
+	}
+}
+
+// TestReplayMismatch checks that a diverging command is reported
+func TestReplayMismatch(t *testing.T) {
+	events := recordSession(t)
+
+	replay := NewReplayTransport(events, 0)
+	address := uint16(8)
+	lora, err := CreateConnectionTransport(replay, Configuration{Address: &address}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+	lora.SendMessage(2, []byte("a \"quoted\"\tline"))
+
+	<-replay.Done()
+	mismatches := replay.Mismatches()
+	if len(mismatches) != 1 || string(mismatches[0].Got) != "AT+ADDRESS=8\r\n" {
+		t.Fatalf("unexpected mismatches %+v", mismatches)
+	}
+}
@@ -2,6 +2,11 @@ package krylr896
 
 // data schema and constant definitions for the radio
 
+import (
+	"context"
+	"time"
+)
+
 //
 // Error and Command structures
 //
@@ -14,6 +19,13 @@ type ErrorEvent struct {
 type Command struct {
 	Text         string
 	ResponseChan chan CommandResponse // channel to receive response on
+	Priority     Priority             // queued commands are sent highest priority first, normal by default
+	Deadline     time.Time            // a command still queued at its deadline fails with ErrExpired, zero for none
+
+	onResponse func(CommandResponse) *ErrorEvent // run by the command loop on success before the next command is sent, a returned error replaces the response's
+	ctx        context.Context                   // a command whose context has ended is withdrawn instead of sent, nil for raw commands
+	onWritten  func(time.Time)                   // run by the command loop once the command is written to the port
+	onDone     func(CommandResponse)             // run with the outcome before it is sent on ResponseChan, must not block
 }
 
 type CommandResponse struct {
@@ -29,7 +41,7 @@ type CommandResponse struct {
 type Configuration struct {
 	Address       *uint16     // ADDRESS, 		0-65535,															ident of the transciever
 	NetworkID     *uint8      // NETWORKID, 	0-16,																must be the same for radios to communicate
-	Band          *uint32     // BAND(Hz), 		433000000-915000000,												center freq of wireless band
+	Band          *uint32     // BAND(Hz), 		410000000-1020000000,												center freq of wireless band
 	Parameter     *Parameters // PARAMETER, 																		rf params
 	Mode          *uint8      // MODE, 			0-1,																work mode
 	UartBaudRate  *int        // IPR, 			300-115200, 														uart baud rate
@@ -46,6 +58,30 @@ type Parameters struct {
 	ProgrammedPreamble uint8 // PP, 4-7
 }
 
+//
+// connection setup
+//
+
+// optional connection behaviour, the zero value keeps the defaults
+type ConnectionOptions struct {
+	Debug         bool                          // enable debug logging
+	DebugName     string                        // debug name prefix for logging
+	DebugFunc     func(name string, msg string) // debug callback function
+	AutoBaud      bool                          // if the module does not answer at the requested baud rate, try the other UartBaudRates
+	RestoreBaud   bool                          // after auto-baud, switch the module back to the requested baud rate with AT+IPR
+	Timing        *CommandTiming                // command timeouts and pacing, defaults when nil
+	PayloadCodec  PayloadCodec                  // encoding applied to message data, none when nil
+	Reconnect     *ReconnectOptions             // reopen the link when the port fails, disabled when nil
+	Watchdog      *WatchdogOptions              // probe an idle link and reset the module when it stops answering, disabled when nil
+	IdentifyModel bool                          // call DeviceInfo before applying the configuration so it is checked against the model's limits, connecting fails if the module does not answer
+}
+
+// per message send settings
+type SendOptions struct {
+	Priority Priority  // queued messages are sent highest priority first
+	Deadline time.Time // a message still queued at its deadline fails with ErrExpired, zero for none
+}
+
 //
 // Response Structures
 //
@@ -0,0 +1,299 @@
+// Package simulator connects emulated modules through a virtual RF medium, frames are delivered
+// between nodes with matching radio settings, with RSSI and SNR derived from a path loss model,
+// random packet loss and collisions between transmissions that overlap in time on air
+package simulator
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	krylr896 "github.com/1kharvey/k-rylr896"
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// snrLimit is the demodulation floor in dB for each spreading factor
+var snrLimit = map[uint8]float64{7: -7.5, 8: -10, 9: -12.5, 10: -15, 11: -17.5, 12: -20}
+
+// Position is a node location in metres
+type Position struct {
+	X float64
+	Y float64
+}
+
+// distance returns the distance between two positions in metres
+func distance(a, b Position) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// PathLossModel computes the attenuation in dB over a distance in metres at a frequency in Hz
+type PathLossModel interface {
+	PathLoss(distance float64, frequency uint32) float64
+}
+
+// FreeSpace is the free space path loss model
+type FreeSpace struct{}
+
+// PathLoss implements PathLossModel
+func (FreeSpace) PathLoss(distance float64, frequency uint32) float64 {
+	if distance < 1 {
+		distance = 1
+	}
+	return 20*math.Log10(distance) + 20*math.Log10(float64(frequency)) - 147.55
+}
+
+// LogDistance is the log-distance path loss model, free space up to ReferenceDistance then
+// attenuating with Exponent
+type LogDistance struct {
+	ReferenceDistance float64 // metres, 1 when zero
+	Exponent          float64 // 2 is free space, 2.7-3.5 urban, 4-6 indoors
+}
+
+// PathLoss implements PathLossModel
+func (l LogDistance) PathLoss(distance float64, frequency uint32) float64 {
+	ref := l.ReferenceDistance
+	if ref <= 0 {
+		ref = 1
+	}
+	if distance < ref {
+		distance = ref
+	}
+	return FreeSpace{}.PathLoss(ref, frequency) + 10*l.Exponent*math.Log10(distance/ref)
+}
+
+// Config holds the properties of the virtual medium
+type Config struct {
+	PathLoss         PathLossModel // FreeSpace when nil
+	NoiseFloor       float64       // dBm, -120 when zero
+	PacketLoss       float64       // probability 0-1 that an otherwise good frame is lost
+	CaptureThreshold float64       // dB a frame must exceed an overlapping one by to survive, 6 when zero
+	Seed             int64         // seed for the packet loss generator
+}
+
+// Stats counts what happened on the medium
+type Stats struct {
+	Transmitted int // frames sent
+	Delivered   int // receptions reported to a module
+	Collided    int // receptions lost to overlapping transmissions
+	Lost        int // receptions lost to random packet loss
+	OutOfRange  int // receptions below the demodulation floor
+}
+
+// transmission is a frame on air
+type transmission struct {
+	sender *Node
+	frame  emulator.Frame
+	start  time.Time
+	end    time.Time
+	done   bool // delivery has been evaluated
+}
+
+// Network is a virtual medium shared by simulated nodes
+type Network struct {
+	mu     sync.Mutex
+	config Config
+	rng    *rand.Rand
+	nodes  []*Node
+	onAir  []*transmission // transmissions that may still overlap a pending one
+	stats  Stats
+}
+
+// Node is a simulated module at a position on the network
+type Node struct {
+	Name     string
+	network  *Network
+	module   *emulator.Module
+	position Position // guarded by network.mu
+}
+
+// NewNetwork creates an empty medium
+func NewNetwork(config Config) *Network {
+	if config.PathLoss == nil {
+		config.PathLoss = FreeSpace{}
+	}
+	if config.NoiseFloor == 0 {
+		config.NoiseFloor = -120
+	}
+	if config.CaptureThreshold == 0 {
+		config.CaptureThreshold = 6
+	}
+	return &Network{config: config, rng: rand.New(rand.NewSource(config.Seed))}
+}
+
+// AddNode places a new emulated module with the given state on the network
+func (n *Network) AddNode(name string, position Position, state emulator.State) *Node {
+	node := &Node{Name: name, network: n, module: emulator.NewWithState(state), position: position}
+	node.module.SetTransmitHandler(func(frame emulator.Frame) {
+		n.transmit(node, frame)
+	})
+
+	n.mu.Lock()
+	n.nodes = append(n.nodes, node)
+	n.mu.Unlock()
+	return node
+}
+
+// Stats returns the counters of the medium
+func (n *Network) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// Module returns the node's emulated module
+func (node *Node) Module() *emulator.Module {
+	return node.module
+}
+
+// Attach connects a host to the node's UART, pass it to krylr896.CreateConnectionTransport
+func (node *Node) Attach() *emulator.Conn {
+	return node.module.Attach()
+}
+
+// Position returns where the node is
+func (node *Node) Position() Position {
+	node.network.mu.Lock()
+	defer node.network.mu.Unlock()
+	return node.position
+}
+
+// Move relocates the node, it applies to frames sent afterwards
+func (node *Node) Move(position Position) {
+	node.network.mu.Lock()
+	defer node.network.mu.Unlock()
+	node.position = position
+}
+
+// toParameters converts emulator parameters for the airtime calculation
+func toParameters(p emulator.Parameters) krylr896.Parameters {
+	return krylr896.Parameters{
+		SpreadingFactor:    p.SpreadingFactor,
+		Bandwidth:          p.Bandwidth,
+		CodingRate:         p.CodingRate,
+		ProgrammedPreamble: p.ProgrammedPreamble,
+	}
+}
+
+// transmit puts a frame on air and schedules its delivery when the transmission ends
+func (n *Network) transmit(sender *Node, frame emulator.Frame) {
+	airtime := krylr896.TimeOnAir(toParameters(frame.Parameters), len(frame.Data))
+	now := time.Now()
+	tx := &transmission{sender: sender, frame: frame, start: now, end: now.Add(airtime)}
+
+	n.mu.Lock()
+	n.onAir = append(n.onAir, tx)
+	n.stats.Transmitted++
+	n.mu.Unlock()
+
+	time.AfterFunc(airtime, func() {
+		n.deliver(tx)
+	})
+}
+
+// compatible reports whether a receiver's settings let it demodulate a frame
+func compatible(frame emulator.Frame, state emulator.State) bool {
+	return frame.Band == state.Band &&
+		frame.NetworkID == state.NetworkID &&
+		frame.Password == state.Password &&
+		frame.Parameters.SpreadingFactor == state.Parameters.SpreadingFactor &&
+		frame.Parameters.Bandwidth == state.Parameters.Bandwidth &&
+		frame.Parameters.CodingRate == state.Parameters.CodingRate
+}
+
+// rssiAt is the received power in dBm of a transmission at a receiver, caller holds n.mu
+func (n *Network) rssiAt(tx *transmission, receiver *Node) float64 {
+	d := distance(tx.sender.position, receiver.position)
+	return float64(tx.frame.RFOutputPower) - n.config.PathLoss.PathLoss(d, tx.frame.Band)
+}
+
+// deliver evaluates a finished transmission at every other node
+func (n *Network) deliver(tx *transmission) {
+	type reception struct {
+		node *Node
+		rssi int
+		snr  int
+	}
+	var receptions []reception
+
+	n.mu.Lock()
+	for _, node := range n.nodes {
+		if node == tx.sender {
+			continue
+		}
+		state := node.module.State()
+		if !compatible(tx.frame, state) {
+			continue
+		}
+
+		rssi := n.rssiAt(tx, node)
+		snr := rssi - n.config.NoiseFloor
+		if snr < snrLimit[tx.frame.Parameters.SpreadingFactor] {
+			n.stats.OutOfRange++
+			continue
+		}
+		if n.collides(tx, node, rssi) {
+			n.stats.Collided++
+			continue
+		}
+		if n.config.PacketLoss > 0 && n.rng.Float64() < n.config.PacketLoss {
+			n.stats.Lost++
+			continue
+		}
+		receptions = append(receptions, reception{node: node, rssi: clamp(rssi), snr: clamp(snr)})
+	}
+	tx.done = true
+	n.prune()
+	n.mu.Unlock()
+
+	for _, r := range receptions {
+		if r.node.module.Deliver(tx.frame, r.rssi, r.snr) {
+			n.mu.Lock()
+			n.stats.Delivered++
+			n.mu.Unlock()
+		}
+	}
+}
+
+// collides reports whether another transmission overlapping tx spoils its reception at receiver,
+// a receiver that is itself transmitting hears nothing, caller holds n.mu
+func (n *Network) collides(tx *transmission, receiver *Node, rssi float64) bool {
+	for _, other := range n.onAir {
+		if other == tx || other.frame.Band != tx.frame.Band {
+			continue
+		}
+		if !other.start.Before(tx.end) || !other.end.After(tx.start) {
+			continue
+		}
+		if other.sender == receiver {
+			return true
+		}
+		if rssi-n.rssiAt(other, receiver) < n.config.CaptureThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets transmissions that can no longer overlap one whose delivery is pending, caller holds n.mu
+func (n *Network) prune() {
+	var earliest time.Time
+	for _, tx := range n.onAir {
+		if !tx.done && (earliest.IsZero() || tx.start.Before(earliest)) {
+			earliest = tx.start
+		}
+	}
+
+	kept := n.onAir[:0]
+	for _, tx := range n.onAir {
+		if !tx.done || (!earliest.IsZero() && tx.end.After(earliest)) {
+			kept = append(kept, tx)
+		}
+	}
+	n.onAir = kept
+}
+
+// clamp rounds a dB value into the range the module reports
+func clamp(v float64) int {
+	return int(math.Max(-128, math.Min(127, math.Round(v))))
+}
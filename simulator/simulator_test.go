@@ -0,0 +1,105 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	krylr896 "github.com/1kharvey/k-rylr896"
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// fastState is a node state with short airtime
+func fastState(address uint16, networkID uint8) emulator.State {
+	state := emulator.DefaultState()
+	state.Address = address
+	state.NetworkID = networkID
+	state.Parameters = emulator.Parameters{SpreadingFactor: 7, Bandwidth: 9, CodingRate: 1, ProgrammedPreamble: 4}
+	return state
+}
+
+// messageSender is the part of a library connection the tests send with
+type messageSender interface {
+	SendMessage(address uint16, data []byte) *krylr896.ErrorEvent
+}
+
+// connect attaches a library connection to a node
+func connect(t *testing.T, node *Node) messageSender {
+	t.Helper()
+	lora, err := krylr896.CreateConnectionTransport(node.Attach(), krylr896.Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("connect %s: %v", node.Name, err.Err)
+	}
+	t.Cleanup(func() { lora.CloseConnection() })
+	return lora
+}
+
+// TestDelivery checks who hears a broadcast
+func TestDelivery(t *testing.T) {
+	network := NewNetwork(Config{})
+	sender := network.AddNode("sender", Position{0, 0}, fastState(1, 3))
+	near := network.AddNode("near", Position{100, 0}, fastState(2, 3))
+	otherNet := network.AddNode("other-network", Position{100, 0}, fastState(3, 4))
+	far := network.AddNode("far", Position{1e9, 0}, fastState(4, 3))
+
+	nearLora, err := krylr896.CreateConnectionTransport(near.Attach(), krylr896.Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("connect near: %v", err.Err)
+	}
+	defer nearLora.CloseConnection()
+	otherNet.Attach()
+	far.Attach()
+
+	if sendErr := connect(t, sender).SendMessage(0, []byte("ping")); sendErr != nil {
+		t.Fatalf("send: %v", sendErr.Err)
+	}
+
+	select {
+	case msg := <-nearLora.RecievedData:
+		if msg.Address != 1 || string(msg.Data[:msg.Length]) != "ping" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+		if msg.ReceivedSignalStrengthIndicator > 0 || msg.ReceivedSignalStrengthIndicator < -128 {
+			t.Fatalf("implausible RSSI %d", msg.ReceivedSignalStrengthIndicator)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("near node did not receive the frame")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	stats := network.Stats()
+	if stats.Transmitted != 1 || stats.Delivered != 1 || stats.OutOfRange != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// TestCollision checks that two equally strong overlapping transmissions are both lost
+func TestCollision(t *testing.T) {
+	network := NewNetwork(Config{})
+	slow := fastState(0, 0)
+	slow.Parameters = emulator.Parameters{SpreadingFactor: 10, Bandwidth: 7, CodingRate: 1, ProgrammedPreamble: 4}
+
+	a := network.AddNode("a", Position{-100, 0}, withAddress(slow, 1))
+	b := network.AddNode("b", Position{100, 0}, withAddress(slow, 2))
+	network.AddNode("receiver", Position{0, 0}, withAddress(slow, 3)).Attach()
+
+	loraA, loraB := connect(t, a), connect(t, b)
+	done := make(chan struct{})
+	go func() {
+		loraB.SendMessage(3, []byte("from b"))
+		close(done)
+	}()
+	loraA.SendMessage(3, []byte("from a"))
+	<-done
+
+	time.Sleep(500 * time.Millisecond)
+	stats := network.Stats()
+	if stats.Collided < 2 || stats.Delivered != 0 {
+		t.Fatalf("expected a collision, got %+v", stats)
+	}
+}
+
+// withAddress returns state with the address replaced
+func withAddress(state emulator.State, address uint16) emulator.State {
+	state.Address = address
+	return state
+}
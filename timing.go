@@ -0,0 +1,86 @@
+package krylr896
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timing defaults
+const (
+	defaultCommandTimeout = 10 * time.Second
+	defaultSendMargin     = time.Second
+	defaultCommandGap     = 4 * time.Millisecond // I've reached out to the manufacturer to ask why this is necessary
+)
+
+// CommandTiming controls how long commands may take and the pause between them, zero fields keep the defaults
+type CommandTiming struct {
+	DefaultTimeout time.Duration            // timeout for commands without a specific one, 10s when zero
+	Timeouts       map[string]time.Duration // per command name, e.g. "RESET", "ADDRESS" or "SEND", overrides the defaults
+	SendMargin     time.Duration            // added to the computed time on air for AT+SEND, 1s when zero
+	CommandGap     *time.Duration           // pause after a response before the next command is sent, 4ms when nil
+}
+
+// SetCommandTiming replaces the command timing, it applies to commands sent afterwards
+func (Lora *lora) SetCommandTiming(timing CommandTiming) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	Lora.timing = timing
+}
+
+// setParameters records the RF parameters the module was last set to
+func (Lora *lora) setParameters(params Parameters) {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	Lora.params = &params
+}
+
+// commandTimeout returns how long the module may take to answer cmd, AT+SEND is allowed the time
+// on air of its payload with the current parameters plus a margin
+func (Lora *lora) commandTimeout(cmd string) time.Duration {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+
+	name := commandName(cmd)
+	if timeout, ok := Lora.timing.Timeouts[name]; ok {
+		return timeout
+	}
+
+	timeout := Lora.timing.DefaultTimeout
+	if timeout == 0 {
+		timeout = defaultCommandTimeout
+	}
+	if name != "SEND" || strings.HasSuffix(cmd, "?") {
+		return timeout
+	}
+
+	// AT+SEND=<address>,<length>,<data>
+	fields := strings.SplitN(strings.TrimPrefix(cmd, "AT+SEND="), ",", 3)
+	if len(fields) < 2 {
+		return timeout
+	}
+	length, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return timeout
+	}
+
+	margin := Lora.timing.SendMargin
+	if margin == 0 {
+		margin = defaultSendMargin
+	}
+	if Lora.params == nil {
+		// parameters unknown, allow for the factory settings without going below the default
+		return max(timeout, TimeOnAir(DefaultParameters, length)+margin)
+	}
+	return TimeOnAir(*Lora.params, length) + margin
+}
+
+// commandGap returns the pause to leave after a response
+func (Lora *lora) commandGap() time.Duration {
+	Lora.mu.Lock()
+	defer Lora.mu.Unlock()
+	if Lora.timing.CommandGap == nil {
+		return defaultCommandGap
+	}
+	return *Lora.timing.CommandGap
+}
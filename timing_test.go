@@ -0,0 +1,58 @@
+package krylr896
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCommandTimeout checks the timeout chosen for plain commands and for AT+SEND
+func TestCommandTimeout(t *testing.T) {
+	Lora := &lora{}
+	if got := Lora.commandTimeout("AT+ADDRESS=1"); got != defaultCommandTimeout {
+		t.Errorf("default timeout %v, want %v", got, defaultCommandTimeout)
+	}
+
+	// parameters unknown, the factory settings are assumed without going below the default
+	want := max(defaultCommandTimeout, TimeOnAir(DefaultParameters, 240)+defaultSendMargin)
+	if got := Lora.commandTimeout("AT+SEND=0,240," + strings.Repeat("a", 240)); got != want {
+		t.Errorf("send timeout %v, want %v", got, want)
+	}
+
+	params := Parameters{SpreadingFactor: 7, Bandwidth: Bandwidth125KHz, CodingRate: 1, ProgrammedPreamble: 8}
+	Lora.setParameters(params)
+	Lora.SetCommandTiming(CommandTiming{
+		DefaultTimeout: 2 * time.Second,
+		Timeouts:       map[string]time.Duration{"RESET": 5 * time.Second},
+		SendMargin:     100 * time.Millisecond,
+	})
+	want = TimeOnAir(params, 10) + 100*time.Millisecond
+	if got := Lora.commandTimeout("AT+SEND=0,10,0123456789"); got != want {
+		t.Errorf("send timeout %v, want %v", got, want)
+	}
+	if got := Lora.commandTimeout("AT+RESET"); got != 5*time.Second {
+		t.Errorf("reset timeout %v, want 5s", got)
+	}
+	if got := Lora.commandTimeout("AT+VER?"); got != 2*time.Second {
+		t.Errorf("query timeout %v, want 2s", got)
+	}
+}
+
+// TestCommandTimeoutOverride checks that a per-command timeout applies to a lost response
+func TestCommandTimeoutOverride(t *testing.T) {
+	lora, _, _ := faultConnection(t, FaultRule{Kind: FaultDropLine, Match: "+OK", Nth: 1})
+	lora.SetCommandTiming(CommandTiming{Timeouts: map[string]time.Duration{"ADDRESS": 100 * time.Millisecond}})
+
+	start := time.Now()
+	_, err := lora.SendCommand("AT+ADDRESS=4")
+	if err == nil || !strings.Contains(err.Err.Error(), "timeout after 100ms") {
+		t.Fatalf("expected a 100ms timeout, got %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout took %v", elapsed)
+	}
+
+	if _, err := lora.SendCommand("AT+ADDRESS=4"); err != nil {
+		t.Fatalf("command after timeout failed: %v", err.Err)
+	}
+}
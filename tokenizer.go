@@ -0,0 +1,203 @@
+package krylr896
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// maxPayload is the most data bytes a single frame can carry
+const maxPayload = 240
+
+// frameGapTimeout is how long the reader waits for the rest of a +RCV frame, the module sends a frame
+// back to back so a pause this long means bytes were lost
+const frameGapTimeout = 250 * time.Millisecond
+
+// rcvPrefix starts every received message
+var rcvPrefix = []byte("+RCV=")
+
+// FrameParseError reports module output that could not be parsed and was discarded
+type FrameParseError struct {
+	Reason string // what was wrong with the frame
+	Data   []byte // the discarded bytes
+}
+
+func (e *FrameParseError) Error() string {
+	return fmt.Sprintf("malformed frame, %s: %q", e.Reason, e.Data)
+}
+
+// tokenizer splits the module's output into lines, +RCV frames are measured by their length field
+// so payloads may contain CR and LF
+type tokenizer struct {
+	buf        []byte
+	discarding bool // skipping the rest of a malformed frame
+}
+
+// push adds received bytes
+func (tk *tokenizer) push(p []byte) {
+	tk.buf = append(tk.buf, p...)
+}
+
+// pending reports whether a +RCV frame has started but not completed
+func (tk *tokenizer) pending() bool {
+	return !tk.discarding && bytes.HasPrefix(tk.buf, rcvPrefix)
+}
+
+// next returns the next complete line or frame, or an error for bytes that were discarded,
+// ok is false when more input is needed
+func (tk *tokenizer) next() (token string, parseErr *FrameParseError, ok bool) {
+	for tk.discarding {
+		at := resyncPoint(tk.buf, 0)
+		if at == -1 {
+			// keep enough to recognise a frame prefix split across reads
+			if keep := len(rcvPrefix) - 1; len(tk.buf) > keep {
+				tk.buf = tk.buf[len(tk.buf)-keep:]
+			}
+			return "", nil, false
+		}
+		tk.buf = tk.buf[at:]
+		tk.discarding = false
+	}
+
+	frameAt := bytes.Index(tk.buf, rcvPrefix)
+	lineEnd := bytes.IndexByte(tk.buf, '\n')
+
+	switch {
+	case frameAt == 0:
+		n, more, reason := scanFrame(tk.buf)
+		if more {
+			return "", nil, false
+		}
+		if reason != "" {
+			return "", tk.discard(reason), true
+		}
+		token = string(tk.buf[:n])
+		tk.buf = tk.buf[n:]
+		return token, nil, true
+
+	case frameAt > 0 && (lineEnd == -1 || frameAt < lineEnd):
+		// noise in front of a frame
+		parseErr = &FrameParseError{Reason: "unexpected bytes before +RCV", Data: append([]byte(nil), tk.buf[:frameAt]...)}
+		tk.buf = tk.buf[frameAt:]
+		return "", parseErr, true
+
+	case lineEnd != -1:
+		token = string(tk.buf[:lineEnd+1])
+		tk.buf = tk.buf[lineEnd+1:]
+		return token, nil, true
+	}
+	return "", nil, false
+}
+
+// flush gives up on a frame that stopped arriving
+func (tk *tokenizer) flush() *FrameParseError {
+	if !tk.pending() {
+		return nil
+	}
+	return tk.discard("truncated frame")
+}
+
+// discard drops a malformed frame at the start of the buffer up to the next line end or frame
+func (tk *tokenizer) discard(reason string) *FrameParseError {
+	at := resyncPoint(tk.buf, 1)
+	if at == -1 {
+		parseErr := &FrameParseError{Reason: reason, Data: append([]byte(nil), tk.buf...)}
+		tk.buf = tk.buf[:0]
+		tk.discarding = true
+		return parseErr
+	}
+	parseErr := &FrameParseError{Reason: reason, Data: append([]byte(nil), tk.buf[:at]...)}
+	tk.buf = tk.buf[at:]
+	return parseErr
+}
+
+// resyncPoint returns where parsing can resume after from, just past the next line end or at the next
+// frame prefix, whichever is first, or -1 if neither has arrived
+func resyncPoint(buf []byte, from int) int {
+	if from > len(buf) {
+		return -1
+	}
+	at := -1
+	if idx := bytes.IndexByte(buf[from:], '\n'); idx != -1 {
+		at = from + idx + 1
+	}
+	if idx := bytes.Index(buf[from:], rcvPrefix); idx != -1 && (at == -1 || from+idx < at) {
+		at = from + idx
+	}
+	return at
+}
+
+// scanFrame measures the frame at the start of buf, +RCV=<Address>,<Length>,<Data>,<RSSI>,<SNR>\r\n,
+// it returns the frame's size, more if buf ends before the frame does, or why the frame is malformed
+func scanFrame(buf []byte) (n int, more bool, reason string) {
+	i := len(rcvPrefix)
+
+	// address and length
+	length := 0
+	for field := 0; field < 2; field++ {
+		start := i
+		value := 0
+		for i < len(buf) && isDigit(buf[i]) && i-start < 5 {
+			value = value*10 + int(buf[i]-'0')
+			i++
+		}
+		if i == len(buf) {
+			return 0, true, ""
+		}
+		if i == start || buf[i] != ',' {
+			return 0, false, "malformed header"
+		}
+		length = value
+		i++
+	}
+	if length > maxPayload {
+		return 0, false, fmt.Sprintf("length %d exceeds %d", length, maxPayload)
+	}
+
+	// data
+	i += length
+	if i > len(buf) {
+		return 0, true, ""
+	}
+
+	// RSSI and SNR
+	for field := 0; field < 2; field++ {
+		if i == len(buf) {
+			return 0, true, ""
+		}
+		if buf[i] != ',' {
+			return 0, false, "malformed trailer"
+		}
+		i++
+		if i < len(buf) && buf[i] == '-' {
+			i++
+		}
+		start := i
+		for i < len(buf) && isDigit(buf[i]) && i-start < 4 {
+			i++
+		}
+		if i == len(buf) {
+			return 0, true, ""
+		}
+		if i == start {
+			return 0, false, "malformed trailer"
+		}
+	}
+
+	// line ending
+	if buf[i] == '\r' {
+		i++
+		if i == len(buf) {
+			return 0, true, ""
+		}
+	}
+	if buf[i] != '\n' {
+		return 0, false, "malformed trailer"
+	}
+	return i + 1, false, ""
+}
+
+// isDigit reports whether b is an ASCII digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
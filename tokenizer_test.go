@@ -0,0 +1,106 @@
+package krylr896
+
+import (
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// tokens feeds input to a tokenizer in chunks of size and collects lines and errors
+func tokens(input string, size int) (lines []string, reasons []string) {
+	var tk tokenizer
+	collect := func() {
+		for {
+			token, parseErr, ok := tk.next()
+			if !ok {
+				return
+			}
+			if parseErr != nil {
+				reasons = append(reasons, parseErr.Reason)
+			} else {
+				lines = append(lines, token)
+			}
+		}
+	}
+	for len(input) > 0 {
+		n := min(size, len(input))
+		tk.push([]byte(input[:n]))
+		input = input[n:]
+		collect()
+	}
+	if parseErr := tk.flush(); parseErr != nil {
+		reasons = append(reasons, parseErr.Reason)
+		collect()
+	}
+	return lines, reasons
+}
+
+// TestTokenizer checks framing of binary payloads and resynchronisation after bad frames
+func TestTokenizer(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		lines   []string
+		reasons []string
+	}{
+		{"lines", "+OK\r\n+ADDRESS=5\r\n", []string{"+OK\r\n", "+ADDRESS=5\r\n"}, nil},
+		{"binary payload", "+RCV=50,5,A\r\nB\n,-99,40\r\n+OK\r\n", []string{"+RCV=50,5,A\r\nB\n,-99,40\r\n", "+OK\r\n"}, nil},
+		{"long length", "+RCV=50,9,HELLO,-99,40\r\n+OK\r\n", []string{"+OK\r\n"}, []string{"malformed trailer"}},
+		{"bad header", "+RCV=5x,5,HELLO,-99,40\r\n+OK\r\n", []string{"+OK\r\n"}, []string{"malformed header"}},
+		{"oversize", "+RCV=50,241,HELLO\r\n+OK\r\n", []string{"+OK\r\n"}, []string{"length 241 exceeds 240"}},
+		{"noise", "\x00\xff+RCV=50,2,HI,-99,40\r\n", []string{"+RCV=50,2,HI,-99,40\r\n"}, []string{"unexpected bytes before +RCV"}},
+		{"truncated", "+RCV=50,200,HELLO,-99,40\r\n+OK\r\n", []string{"+OK\r\n"}, []string{"truncated frame"}},
+		{"frame after bad frame", "+RCV=50,x+RCV=50,2,HI,-99,40\r\n", []string{"+RCV=50,2,HI,-99,40\r\n"}, []string{"malformed header"}},
+	}
+
+	for _, tc := range cases {
+		for _, size := range []int{1, 3, 512} {
+			lines, reasons := tokens(tc.input, size)
+			if len(lines) != len(tc.lines) || len(reasons) != len(tc.reasons) {
+				t.Errorf("%s/%d: got lines %q errors %q", tc.name, size, lines, reasons)
+				continue
+			}
+			for i := range lines {
+				if lines[i] != tc.lines[i] {
+					t.Errorf("%s/%d: line %d = %q, want %q", tc.name, size, i, lines[i], tc.lines[i])
+				}
+			}
+			for i := range reasons {
+				if reasons[i] != tc.reasons[i] {
+					t.Errorf("%s/%d: error %d = %q, want %q", tc.name, size, i, reasons[i], tc.reasons[i])
+				}
+			}
+		}
+	}
+}
+
+// TestEmulatorBinaryReceive receives a payload containing line endings and reports a malformed frame
+func TestEmulatorBinaryReceive(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	module.Inject(50, []byte("A\r\nB\n"), -99, 40)
+	select {
+	case msg := <-lora.RecievedData:
+		if string(msg.Data[:msg.Length]) != "A\r\nB\n" {
+			t.Fatalf("unexpected data: %q", msg.Data[:msg.Length])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	module.InjectRaw([]byte("+RCV=50,x\r\n"))
+	select {
+	case errEvent := <-lora.Errors:
+		if parseErr, ok := errEvent.Err.(*FrameParseError); !ok || parseErr.Reason != "malformed header" {
+			t.Fatalf("unexpected error: %v", errEvent.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for a parse error")
+	}
+}
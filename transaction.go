@@ -0,0 +1,97 @@
+package krylr896
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ConfigTransactionError reports a SetConfigAtomic that failed part way, and what was done to undo it
+type ConfigTransactionError struct {
+	Applied        []string // fields set before the failure, in the order they were sent
+	Failed         string   // field that failed
+	RolledBack     []string // fields restored to their earlier value
+	RollbackFailed []string // fields that could not be restored and may still hold the new value
+	Err            error    // why Failed failed
+}
+
+func (e *ConfigTransactionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed: %v", e.Failed, e.Err)
+	if len(e.Applied) != 0 {
+		fmt.Fprintf(&b, "; applied %s", strings.Join(e.Applied, ", "))
+	}
+	if len(e.RolledBack) != 0 {
+		fmt.Fprintf(&b, "; rolled back %s", strings.Join(e.RolledBack, ", "))
+	}
+	if len(e.RollbackFailed) != 0 {
+		fmt.Fprintf(&b, "; could not roll back %s", strings.Join(e.RollbackFailed, ", "))
+	}
+	return b.String()
+}
+
+func (e *ConfigTransactionError) Unwrap() error {
+	return e.Err
+}
+
+// SetConfigAtomic applies a configuration like SetConfig, but when a field fails every field already set
+// is restored to the value it held before, the error is then a *ConfigTransactionError
+func (Lora *lora) SetConfigAtomic(config Configuration) *ErrorEvent {
+	return Lora.SetConfigAtomicContext(context.Background(), config)
+}
+
+// SetConfigAtomicContext is SetConfigAtomic, stopping at the next field when ctx ends. The rollback runs
+// even when ctx has ended
+func (Lora *lora) SetConfigAtomicContext(ctx context.Context, config Configuration) *ErrorEvent {
+	if err := config.ValidateFor(Lora.Capabilities()); err != nil {
+		return &ErrorEvent{Code: nil, Err: err}
+	}
+
+	snapshot, err := Lora.GetConfigContext(ctx)
+	if err != nil {
+		if err.Err != nil {
+			return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to snapshot configuration: %w", err.Err)}
+		}
+		return &ErrorEvent{Code: err.Code, Err: fmt.Errorf("failed to snapshot configuration")}
+	}
+
+	var applied []string
+	for _, field := range reconcileOrder {
+		single, ok := configField(config, field)
+		if !ok {
+			continue
+		}
+		err := Lora.SetConfigContext(ctx, single)
+		if err == nil {
+			applied = append(applied, field)
+			continue
+		}
+
+		txErr := &ConfigTransactionError{Applied: applied, Failed: field, Err: err.Err}
+
+		// a field the module rejected is unchanged, anything else (a timeout, a lost link) may have
+		// reached it, so that field is restored too
+		undo := applied
+		if err.Code == nil || *err.Code == UNK_ERR {
+			undo = append(append([]string(nil), applied...), field)
+		}
+		txErr.RolledBack, txErr.RollbackFailed = Lora.rollback(context.WithoutCancel(ctx), snapshot, undo)
+		return &ErrorEvent{Code: err.Code, Err: txErr}
+	}
+	return nil
+}
+
+// rollback restores fields from snapshot, newest first, the values are sent without validation as the
+// module already held them
+func (Lora *lora) rollback(ctx context.Context, snapshot Configuration, fields []string) (restored []string, failed []string) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		single, _ := configField(snapshot, fields[i])
+		if err := Lora.applyConfig(ctx, single); err != nil {
+			Lora.debugLog("Rollback of %s failed: %v", fields[i], err.Err)
+			failed = append(failed, fields[i])
+			continue
+		}
+		restored = append(restored, fields[i])
+	}
+	return restored, failed
+}
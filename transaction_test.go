@@ -0,0 +1,79 @@
+package krylr896
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestSetConfigAtomic checks that a failure part way restores the fields already set
+func TestSetConfigAtomic(t *testing.T) {
+	module := emulator.New()
+	faults := NewFaultTransport(module.Attach(), 1, FaultRule{Kind: FaultWriteError, Match: "AT+CPIN=", Nth: 1})
+	lora, err := CreateConnectionTransport(faults, Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+	before := module.State()
+
+	address := uint16(4)
+	networkID := uint8(2)
+	band := BandINDIA
+	key := [16]byte{0xfa, 0xbc}
+	rfPower := uint8(8)
+	err = lora.SetConfigAtomic(Configuration{Address: &address, NetworkID: &networkID, Band: &band, EncryptionKey: &key, RFOutputPower: &rfPower})
+	if err == nil {
+		t.Fatal("expected the injected write failure")
+	}
+	var txErr *ConfigTransactionError
+	if !errors.As(err.Err, &txErr) || !errors.Is(err.Err, ErrInjectedWrite) {
+		t.Fatalf("expected a *ConfigTransactionError wrapping the write failure, got %v", err.Err)
+	}
+	if txErr.Failed != "CPIN" || !reflect.DeepEqual(txErr.Applied, []string{"ADDRESS", "NETWORKID", "BAND"}) ||
+		!reflect.DeepEqual(txErr.RolledBack, []string{"CPIN", "BAND", "NETWORKID", "ADDRESS"}) || len(txErr.RollbackFailed) != 0 {
+		t.Fatalf("unexpected transaction error %+v", txErr)
+	}
+	if after := module.State(); !reflect.DeepEqual(after, before) {
+		t.Fatalf("module not restored:\n got %+v\nwant %+v", after, before)
+	}
+
+	// the same configuration goes through once the fault has fired
+	if err := lora.SetConfigAtomic(Configuration{Address: &address, EncryptionKey: &key}); err != nil {
+		t.Fatalf("SetConfigAtomic failed: %v", err.Err)
+	}
+	if state := module.State(); state.Address != address || state.Password != key {
+		t.Fatalf("configuration not applied: %+v", state)
+	}
+}
+
+// TestSetConfigAtomicRollbackUnvalidated checks that a snapshot value outside the validator's limits is
+// still restored, here a 915 MHz band on a module identified as a 433 MHz model
+func TestSetConfigAtomicRollbackUnvalidated(t *testing.T) {
+	state := emulator.DefaultState()
+	state.Version = "RYLR40C_V1.0.1"
+	state.Band = BandUSA
+	module := emulator.NewWithState(state)
+	faults := NewFaultTransport(module.Attach(), 1, FaultRule{Kind: FaultWriteError, Match: "AT+MODE=", Nth: 1})
+	lora, err := CreateConnectionTransportWithOptions(faults, 0, Configuration{}, 10, ConnectionOptions{IdentifyModel: true})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	band := BandCHINA
+	mode := MODE_SLEEP
+	err = lora.SetConfigAtomic(Configuration{Band: &band, Mode: &mode})
+	var txErr *ConfigTransactionError
+	if err == nil || !errors.As(err.Err, &txErr) {
+		t.Fatalf("expected a *ConfigTransactionError, got %+v", err)
+	}
+	if len(txErr.RollbackFailed) != 0 || !reflect.DeepEqual(txErr.RolledBack, []string{"MODE", "BAND"}) {
+		t.Fatalf("unexpected transaction error %+v", txErr)
+	}
+	if after := module.State(); after.Band != BandUSA || after.Mode != state.Mode {
+		t.Fatalf("module not restored: %+v", after)
+	}
+}
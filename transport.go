@@ -0,0 +1,98 @@
+package krylr896
+
+import (
+	"errors"
+	"io"
+
+	"go.bug.st/serial"
+)
+
+// Transport is the byte stream the radio is attached to, a serial port, pipe, socket or test double
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// BaudRateSetter is implemented by transports that can change the host side UART speed
+type BaudRateSetter interface {
+	SetBaudRate(baudRate int) error
+}
+
+// BaudRateReporter is implemented by transports that know the host side UART speed they are at
+type BaudRateReporter interface {
+	BaudRate() int
+}
+
+// ModemLineController is implemented by transports that can drive the DTR and RTS modem lines
+type ModemLineController interface {
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+}
+
+// ErrNotSupported is returned when a transport lacks an optional capability
+var ErrNotSupported = errors.New("operation not supported by transport")
+
+// setTransportBaudRate changes the host side baud rate if the transport supports it
+func setTransportBaudRate(t Transport, baudRate int) error {
+	if setter, ok := t.(BaudRateSetter); ok {
+		return setter.SetBaudRate(baudRate)
+	}
+	return ErrNotSupported
+}
+
+// transportBaudRate returns the rate the transport reports it is at, 0 if it cannot tell
+func transportBaudRate(t Transport) int {
+	if reporter, ok := t.(BaudRateReporter); ok {
+		return reporter.BaudRate()
+	}
+	return 0
+}
+
+// setTransportDTR drives DTR if the transport supports it
+func setTransportDTR(t Transport, dtr bool) error {
+	if lines, ok := t.(ModemLineController); ok {
+		return lines.SetDTR(dtr)
+	}
+	return ErrNotSupported
+}
+
+// setTransportRTS drives RTS if the transport supports it
+func setTransportRTS(t Transport, rts bool) error {
+	if lines, ok := t.(ModemLineController); ok {
+		return lines.SetRTS(rts)
+	}
+	return ErrNotSupported
+}
+
+// serialTransport adapts a go.bug.st/serial port to the Transport interfaces
+type serialTransport struct {
+	serial.Port
+	mode serial.Mode
+}
+
+// openSerialTransport opens a local serial device as 8N1 at the given baud rate
+func openSerialTransport(serialInterfaceName string, baudRate int) (*serialTransport, error) {
+	mode := serial.Mode{
+		BaudRate: baudRate,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+
+	port, err := serial.Open(serialInterfaceName, &mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serialTransport{Port: port, mode: mode}, nil
+}
+
+// SetBaudRate changes the host side baud rate, keeping the rest of the mode
+func (t *serialTransport) SetBaudRate(baudRate int) error {
+	mode := t.mode
+	mode.BaudRate = baudRate
+	if err := t.Port.SetMode(&mode); err != nil {
+		return err
+	}
+	t.mode = mode
+	return nil
+}
@@ -1,7 +1,6 @@
 package krylr896
 
 import (
-	"bufio"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,30 +9,128 @@ import (
 
 // run this in a goroutine, it will quit when we close
 func run(Lora *lora) {
-	reader := bufio.NewReader(Lora.port)
 	commandInProgress := false
-	var currentResponseChan chan CommandResponse
+	var current Command // the command in flight
 	var commandTimeout <-chan time.Time
+	var currentTimeout time.Duration
+	var gapTimer <-chan time.Time      // set while the pause after a response runs
+	var watchdogTimer <-chan time.Time // set while the link is idle and the watchdog is enabled
+	var resetTimer <-chan time.Time    // set while RTS holds the module in reset
+	var resetCause error               // why the hardware reset was started
+	failures := 0                      // consecutive failed watchdog probes and command timeouts
+
+	// lines and errors from the port reader
+	portLines := Lora.reader.lines
+	portErrors := Lora.reader.errors
+
+	// fail whatever is still pending when the loop exits
+	defer func() {
+		if commandInProgress {
+			respond(current, closedResponse(), Lora.closed)
+		}
+		Lora.queue.close()
+		Lora.failRawCommands()
+		close(Lora.runDone)
+	}()
 
-	// channel to receive lines from the port
-	portLines := make(chan string, 10)
-	portErrors := make(chan error, 1)
+	// send writes a command to the port and starts waiting for its response
+	send := func(cmd Command) {
+		// withdraw commands whose caller has given up while they were queued
+		if cmd.ctx != nil && cmd.ctx.Err() != nil {
+			Lora.debugLog("Withdrawn before sending: %q", cmd.Text)
+			respond(cmd, CommandResponse{Error: &ErrorEvent{Code: nil, Err: fmt.Errorf("command withdrawn: %w", cmd.ctx.Err())}}, Lora.closed)
+			return
+		}
 
-	// goroutine to continuously read from port
-	go func() {
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				portErrors <- err
-				return
+		// send command to port
+		cmdString := cmd.Text + "\r\n"
+		Lora.debugLog("TX: %q", cmdString)
+		_, err := Lora.port.Write([]byte(cmdString))
+		if err != nil {
+			Lora.debugLog("TX Error: %v", err)
+			code := UNK_ERR
+			respond(cmd, CommandResponse{Error: &ErrorEvent{Code: &code, Err: err}}, Lora.closed)
+			return
+		}
+		if cmd.onWritten != nil {
+			cmd.onWritten(time.Now())
+		}
+		watchdogTimer = nil
+
+		commandInProgress = true
+		current = cmd
+		currentTimeout = Lora.commandTimeout(cmd.Text)
+		commandTimeout = time.After(currentTimeout)
+	}
+
+	// unresponsive counts a failure and escalates to a reset once the watchdog's limit is reached, it
+	// reports false when the loop should exit
+	unresponsive := func(err error) bool {
+		failures++
+		Lora.emitLink(LinkEvent{State: LinkUnresponsive, Attempt: failures, Err: err})
+		if failures < Lora.watchdog.maxFailures() {
+			return true
+		}
+		failures = 0
+		pulseCause, ok := Lora.recoverModule(err)
+		if !ok {
+			return false
+		}
+		if pulseCause != nil {
+			// the reset pin is released from the select so nothing waits behind the pulse
+			resetTimer = time.After(resetPulse)
+			resetCause = pulseCause
+			return true
+		}
+		portLines = Lora.reader.lines
+		portErrors = Lora.reader.errors
+		return true
+	}
+
+	// handleLine takes a line from the port as the answer to the command in flight or as unsolicited data
+	handleLine := func(l portLine) {
+		watchdogTimer = nil
+		if l.malformed == nil && commandInProgress && isResponseTo(l.text, current.Text) {
+			// this is a response to our command
+			failures = 0
+			response := parseCommandResponse(l.text, Lora)
+			if current.onResponse != nil && response.Error == nil {
+				response.Error = current.onResponse(response)
 			}
-			Lora.debugLog("RX: %q", line)
-			portLines <- line
+			respond(current, response, Lora.closed)
+			commandInProgress = false
+			current = Command{}
+			commandTimeout = nil
+
+			// pause between commands without blocking the loop
+			if gap := Lora.commandGap(); gap > 0 {
+				gapTimer = time.After(gap)
+			}
+		} else {
+			// this is unsolicited data - classify it
+			Lora.handleUnsolicited(l)
 		}
-	}()
+	}
 
 	for {
+		// probe the module once the link has been idle for the watchdog's interval
+		if Lora.watchdog != nil && !commandInProgress && watchdogTimer == nil && resetTimer == nil {
+			watchdogTimer = time.After(Lora.watchdog.interval())
+		}
+
+		// only one command may be in flight and none is sent during the pause after a response or
+		// while the module is held in reset, the highest priority queued command goes next
+		if !commandInProgress && gapTimer == nil && resetTimer == nil {
+			if cmd, ok := Lora.queue.pop(); ok {
+				send(cmd)
+				continue
+			}
+		}
+
 		select {
+		case <-Lora.closed:
+			return
+
 		case cmd, ok := <-Lora.Commands:
 			if !ok {
 				return
@@ -41,66 +138,155 @@ func run(Lora *lora) {
 			if cmd.Text == "" {
 				return
 			}
+			Lora.queue.push(cmd)
 
-			// send command to port
-			cmdString := cmd.Text + "\r\n"
-			Lora.debugLog("TX: %q", cmdString)
-			_, err := Lora.port.Write([]byte(cmdString))
-			if err != nil {
-				Lora.debugLog("TX Error: %v", err)
-				if cmd.ResponseChan != nil {
-					code := UNK_ERR
-					cmd.ResponseChan <- CommandResponse{Error: &ErrorEvent{Code: &code, Err: err}}
-				}
-				continue
-			}
-
-			commandInProgress = true
-			currentResponseChan = cmd.ResponseChan
-			commandTimeout = time.After(10 * time.Second)
+		case <-Lora.queue.ready:
+			// picked up at the top of the loop
 
-		case line := <-portLines:
-			if commandInProgress {
-				// this is a response to our command
-				response := parseCommandResponse(line, Lora)
-				if currentResponseChan != nil {
-					currentResponseChan <- response
-				}
-				commandInProgress = false
-				currentResponseChan = nil
-				commandTimeout = nil
-
-				// sleep 4ms between commands, I've reached out to the manufacturer to ask why this is necessary
-				time.Sleep(4 * time.Millisecond)
-			} else {
-				// this is unsolicited data - classify it
-				classifyOutput(line, Lora)
-			}
+		case l := <-portLines:
+			handleLine(l)
 
 		case <-commandTimeout:
 			// command timeout occurred
-			if commandInProgress && currentResponseChan != nil {
-				currentResponseChan <- CommandResponse{
+			if commandInProgress {
+				respond(current, CommandResponse{
 					Response: "",
-					Error:    &ErrorEvent{Code: nil, Err: fmt.Errorf("command timeout after 10 seconds")},
-				}
+					Error:    &ErrorEvent{Code: nil, Err: fmt.Errorf("command timeout after %v", currentTimeout)},
+				}, Lora.closed)
 			}
 			commandInProgress = false
-			currentResponseChan = nil
+			current = Command{}
 			commandTimeout = nil
+			if Lora.watchdog != nil && !unresponsive(fmt.Errorf("command timeout after %v", currentTimeout)) {
+				return
+			}
+
+		case <-gapTimer:
+			gapTimer = nil
+
+		case <-resetTimer:
+			resetTimer = nil
+			if !Lora.finishHardReset(resetCause) {
+				return
+			}
+			portLines = Lora.reader.lines
+			portErrors = Lora.reader.errors
+
+		case <-watchdogTimer:
+			watchdogTimer = nil
+			if err := Lora.probeLiveness(); err == nil {
+				failures = 0
+			} else if !unresponsive(err) {
+				return
+			}
 
 		case err := <-portErrors:
+			// the port failing because Close shut it is not an error
+			select {
+			case <-Lora.closed:
+				return
+			default:
+			}
+
+			// the reader queues every line read before the error first, they are handled before it
+			for drained := false; !drained; {
+				select {
+				case l := <-portLines:
+					handleLine(l)
+				default:
+					drained = true
+				}
+			}
+
 			// handle port read error - send to Errors channel
 			select {
 			case Lora.Errors <- ErrorEvent{Code: nil, Err: err}:
 			default:
 				// channel is full, drop error
 			}
+			Lora.emitLink(LinkEvent{State: LinkLost, Err: err})
+			if Lora.reconnect == nil {
+				return
+			}
+
+			// the command in flight may or may not have reached the module, queued ones wait for the link
+			if commandInProgress {
+				respond(current, CommandResponse{Error: &ErrorEvent{Code: nil, Err: fmt.Errorf("connection lost: %w", err)}}, Lora.closed)
+			}
+			commandInProgress = false
+			current = Command{}
+			commandTimeout = nil
+			gapTimer = nil
+			resetTimer = nil
+
+			if !Lora.reconnectLink(err) {
+				return
+			}
+			portLines = Lora.reader.lines
+			portErrors = Lora.reader.errors
+		}
+	}
+}
+
+// closedResponse answers a command that cannot run because the connection is closed
+func closedResponse() CommandResponse {
+	return CommandResponse{Error: &ErrorEvent{Code: nil, Err: ErrClosed}}
+}
+
+// failRawCommands answers the commands waiting in Commands with ErrClosed, Commands stays open so a late
+// sender cannot panic
+func (Lora *lora) failRawCommands() {
+	for {
+		select {
+		case cmd := <-Lora.Commands:
+			respond(cmd, closedResponse(), Lora.closed)
+		default:
 			return
 		}
 	}
 }
 
+// respond delivers the outcome of a command to its sender, once shutdown is closed a sender that is not
+// reading its ResponseChan is skipped so Close cannot block on it
+func respond(cmd Command, response CommandResponse, shutdown <-chan struct{}) {
+	if cmd.onDone != nil {
+		cmd.onDone(response)
+	}
+	if cmd.ResponseChan == nil {
+		return
+	}
+	select {
+	case cmd.ResponseChan <- response:
+	case <-shutdown:
+		select {
+		case cmd.ResponseChan <- response:
+		default:
+		}
+	}
+}
+
+// isResponseTo reports whether a line answers cmd, received messages and notices such as +READY
+// can arrive while a command is in flight and are never taken as its response
+func isResponseTo(line string, cmd string) bool {
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+	if strings.HasPrefix(line, "+RCV=") {
+		return false
+	}
+	if strings.HasPrefix(line, "+OK") || strings.HasPrefix(line, "+ERR=") {
+		return true
+	}
+
+	// query answers (+ADDRESS=1) and action answers (+RESET) carry the command's name
+	name := commandName(cmd)
+	if line == "+"+name || strings.HasPrefix(line, "+"+name+"=") {
+		return true
+	}
+
+	// some firmware answers queries with a bare value, other commands only get the lines above
+	return strings.HasSuffix(cmd, "?") && line != "" && !strings.HasPrefix(line, "+")
+}
+
 // parseCommandResponse parses a command response line and returns a CommandResponse
 func parseCommandResponse(line string, Lora *lora) CommandResponse {
 	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
@@ -126,6 +312,20 @@ func parseCommandResponse(line string, Lora *lora) CommandResponse {
 	return CommandResponse{Response: line, Error: nil}
 }
 
+// handleUnsolicited reports output that is not a command's answer, discarded bytes go to Errors and
+// lines are classified
+func (Lora *lora) handleUnsolicited(l portLine) {
+	if l.malformed == nil {
+		classifyOutput(l.text, Lora)
+		return
+	}
+	select {
+	case Lora.Errors <- ErrorEvent{Code: nil, Err: l.malformed}:
+	default:
+		// channel is full, drop error
+	}
+}
+
 // classifyOutput classifies unsolicited output as either a received message or an error
 func classifyOutput(line string, Lora *lora) {
 	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
@@ -137,6 +337,21 @@ func classifyOutput(line string, Lora *lora) {
 		Lora.debugLog("Detected received message: %q", payload)
 		// parse received message and send to RecievedData channel
 		if msg, ok := parseReceivedMessage(payload, Lora); ok {
+			if codec := Lora.payloadCodec(); codec != nil {
+				data, err := codec.Decode(msg.Data[:msg.Length])
+				if err != nil {
+					Lora.debugLog("Payload decode failed: %v", err)
+					select {
+					case Lora.Errors <- ErrorEvent{Code: nil, Err: fmt.Errorf("payload decode failed: %w", err)}:
+					default:
+						// channel is full, drop error
+						Lora.debugLog("Errors channel full, dropping error")
+					}
+					return
+				}
+				msg.Data = [maxPayload]byte{}
+				msg.Length = uint8(copy(msg.Data[:], data))
+			}
 			Lora.debugLog("Parsed received message: addr=%d, len=%d, rssi=%d, snr=%d",
 				msg.Address, msg.Length, msg.ReceivedSignalStrengthIndicator, msg.SignalToNoiseRatio)
 			select {
@@ -145,6 +360,13 @@ func classifyOutput(line string, Lora *lora) {
 				// channel is full, drop message
 				Lora.debugLog("RecievedData channel full, dropping message")
 			}
+		} else {
+			select {
+			case Lora.Errors <- ErrorEvent{Code: nil, Err: &FrameParseError{Reason: "invalid field", Data: []byte(line)}}:
+			default:
+				// channel is full, drop error
+				Lora.debugLog("Errors channel full, dropping error")
+			}
 		}
 		return
 	}
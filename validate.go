@@ -0,0 +1,127 @@
+package krylr896
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FieldError is a configuration value outside what the module accepts
+type FieldError struct {
+	Field  string // query name, e.g. "NETWORKID", parameters are "PARAMETER.SF", "PARAMETER.BW" and so on
+	Value  string // the rejected value
+	Reason string // the accepted values
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Field, e.Value, e.Reason)
+}
+
+// ValidationError lists every field of a configuration that failed validation
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		msgs[i] = field.Error()
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the field errors, so errors.As finds a *FieldError
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// add records a failed field
+func (e *ValidationError) add(field string, value any, reason string) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Value: fmt.Sprint(value), Reason: reason})
+}
+
+// result returns e, or nil when no field failed
+func (e *ValidationError) result() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks the parameters against the ranges the module accepts, the error is a *ValidationError
+// listing every field that is out of range
+func (p Parameters) Validate() error {
+	var errs ValidationError
+	p.validate(&errs)
+	return errs.result()
+}
+
+// validate adds the parameters' failures to errs
+func (p Parameters) validate(errs *ValidationError) {
+	if p.SpreadingFactor < 7 || p.SpreadingFactor > 12 {
+		errs.add("PARAMETER.SF", p.SpreadingFactor, "must be 7-12")
+	}
+	if p.Bandwidth > Bandwidth500KHz {
+		errs.add("PARAMETER.BW", p.Bandwidth, "must be 0-9")
+	}
+	if p.CodingRate < 1 || p.CodingRate > 4 {
+		errs.add("PARAMETER.CR", p.CodingRate, "must be 1-4")
+	}
+	if p.ProgrammedPreamble < 4 || p.ProgrammedPreamble > 7 {
+		errs.add("PARAMETER.PP", p.ProgrammedPreamble, "must be 4-7")
+	}
+}
+
+// Validate checks the non-nil fields against the values any supported module accepts, the error is a
+// *ValidationError listing every field that is out of range
+func (config Configuration) Validate() error {
+	return config.ValidateFor(GenericCapabilities())
+}
+
+// ValidateFor checks the non-nil fields against the values a module with caps accepts, the error is a
+// *ValidationError listing every field that is out of range
+func (config Configuration) ValidateFor(caps Capabilities) error {
+	var errs ValidationError
+	if config.NetworkID != nil && *config.NetworkID > 16 {
+		errs.add("NETWORKID", *config.NetworkID, "must be 0-16")
+	}
+	if config.Band != nil && !inBandRanges(*config.Band, caps.Bands) {
+		errs.add("BAND", *config.Band, "must be within "+formatBandRanges(caps.Bands))
+	}
+	if config.Parameter != nil {
+		config.Parameter.validate(&errs)
+	}
+	if config.Mode != nil && !slices.Contains(caps.Modes, *config.Mode) {
+		errs.add("MODE", *config.Mode, fmt.Sprintf("must be one of %v", caps.Modes))
+	}
+	if config.UartBaudRate != nil && !slices.Contains(UartBaudRates, *config.UartBaudRate) {
+		errs.add("IPR", *config.UartBaudRate, fmt.Sprintf("must be one of %v", UartBaudRates))
+	}
+	if config.RFOutputPower != nil && *config.RFOutputPower > caps.MaxRFOutputPower {
+		errs.add("CRFOP", *config.RFOutputPower, fmt.Sprintf("must be 0-%d", caps.MaxRFOutputPower))
+	}
+	return errs.result()
+}
+
+// inBandRanges reports whether band lies in one of ranges
+func inBandRanges(band uint32, ranges []BandRange) bool {
+	for _, r := range ranges {
+		if band >= r.Min && band <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBandRanges writes ranges in MHz, e.g. "410-525 MHz or 862-1020 MHz"
+func formatBandRanges(ranges []BandRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = fmt.Sprintf("%d-%d MHz", r.Min/1000000, r.Max/1000000)
+	}
+	return strings.Join(parts, " or ")
+}
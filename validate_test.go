@@ -0,0 +1,130 @@
+package krylr896
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// TestValidate checks that every out of range field is reported at once
+func TestValidate(t *testing.T) {
+	networkID := uint8(16)
+	band := BandEUROPE2
+	baudRate := UartBaudRate_9600
+	valid := Configuration{NetworkID: &networkID, Band: &band, Parameter: &DefaultParameters, UartBaudRate: &baudRate}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	badNetworkID := uint8(17)
+	badBand := uint32(600000000)
+	badMode := uint8(2)
+	badBaudRate := 14400
+	badPower := uint8(16)
+	invalid := Configuration{
+		NetworkID:     &badNetworkID,
+		Band:          &badBand,
+		Parameter:     &Parameters{SpreadingFactor: 6, Bandwidth: 10, CodingRate: 0, ProgrammedPreamble: 8},
+		Mode:          &badMode,
+		UartBaudRate:  &badBaudRate,
+		RFOutputPower: &badPower,
+	}
+	var validationErr *ValidationError
+	if err := invalid.Validate(); !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	want := []string{"NETWORKID", "BAND", "PARAMETER.SF", "PARAMETER.BW", "PARAMETER.CR", "PARAMETER.PP", "MODE", "IPR", "CRFOP"}
+	if len(validationErr.Fields) != len(want) {
+		t.Fatalf("expected %d fields, got %v", len(want), validationErr)
+	}
+	for i, field := range validationErr.Fields {
+		if field.Field != want[i] {
+			t.Errorf("field %d is %s, want %s", i, field.Field, want[i])
+		}
+	}
+
+	if err := (Parameters{SpreadingFactor: 13, Bandwidth: 7, CodingRate: 1, ProgrammedPreamble: 4}).Validate(); err == nil {
+		t.Error("expected SF13 to be rejected")
+	}
+}
+
+// TestValidateBaudRates checks every rate AT+IPR accepts, 28800 and 19200 included
+func TestValidateBaudRates(t *testing.T) {
+	for _, baudRate := range []int{300, 1200, 4800, 9600, 19200, 28800, 38400, 57600, 115200} {
+		if err := (Configuration{UartBaudRate: &baudRate}).Validate(); err != nil {
+			t.Errorf("IPR %d: unexpected error %v", baudRate, err)
+		}
+	}
+	for _, baudRate := range []int{0, 2400, 14400, 230400} {
+		if err := (Configuration{UartBaudRate: &baudRate}).Validate(); err == nil {
+			t.Errorf("IPR %d: expected an error", baudRate)
+		}
+	}
+
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+	baudRate := UartBaudRate_28800
+	if err := lora.SetConfig(Configuration{UartBaudRate: &baudRate}); err != nil {
+		t.Fatalf("SetConfig failed: %v", err.Err)
+	}
+	if module.State().BaudRate != 28800 {
+		t.Fatalf("module at %d", module.State().BaudRate)
+	}
+}
+
+// TestSetConfigValidates checks that nothing is sent when a field is invalid
+func TestSetConfigValidates(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	address := uint16(9)
+	rfPower := uint8(20)
+	err = lora.SetConfig(Configuration{Address: &address, RFOutputPower: &rfPower})
+	var fieldErr *FieldError
+	if err == nil || !errors.As(err.Err, &fieldErr) || fieldErr.Field != "CRFOP" {
+		t.Fatalf("expected a CRFOP validation error, got %+v", err)
+	}
+	if module.State().Address == address {
+		t.Fatal("address sent despite the invalid configuration")
+	}
+}
+
+// TestValidateCombinations checks that every SF and bandwidth in range can be combined, as the module and
+// the emulator accept them
+func TestValidateCombinations(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransport(module.Attach(), Configuration{}, 10)
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.CloseConnection()
+
+	tests := []Parameters{
+		DefaultParameters,
+		{SpreadingFactor: 12, Bandwidth: Bandwidth500KHz, CodingRate: 1, ProgrammedPreamble: 4},
+		{SpreadingFactor: 11, Bandwidth: Bandwidth250KHz, CodingRate: 4, ProgrammedPreamble: 7},
+		{SpreadingFactor: 7, Bandwidth: Bandwidth62_5KHz, CodingRate: 1, ProgrammedPreamble: 4},
+	}
+	for _, params := range tests {
+		if err := params.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", params, err)
+			continue
+		}
+		if err := lora.SetConfig(Configuration{Parameter: &params}); err != nil {
+			t.Errorf("%+v: SetConfig failed: %v", params, err.Err)
+			continue
+		}
+		if state := module.State(); state.Parameters.SpreadingFactor != params.SpreadingFactor || state.Parameters.Bandwidth != params.Bandwidth {
+			t.Errorf("%+v: module at %+v", params, state.Parameters)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package krylr896
+
+import (
+	"fmt"
+	"time"
+)
+
+// watchdog defaults
+const (
+	defaultWatchdogInterval = 30 * time.Second
+	defaultWatchdogTimeout  = time.Second
+	defaultWatchdogFailures = 3
+	resetPulse              = 100 * time.Millisecond // how long RTS holds the module in reset
+)
+
+// WatchdogOptions enables probing an idle link and resetting a module that stops answering
+type WatchdogOptions struct {
+	Interval    time.Duration // idle time before an AT probe, 30s when zero
+	Timeout     time.Duration // how long a probe or a check after a reset waits, 1s when zero
+	MaxFailures int           // consecutive failed probes or command timeouts before a reset, 3 when zero
+}
+
+// interval returns the idle time before a probe
+func (opts *WatchdogOptions) interval() time.Duration {
+	if opts.Interval == 0 {
+		return defaultWatchdogInterval
+	}
+	return opts.Interval
+}
+
+// timeout returns how long a probe waits
+func (opts *WatchdogOptions) timeout() time.Duration {
+	if opts.Timeout == 0 {
+		return defaultWatchdogTimeout
+	}
+	return opts.Timeout
+}
+
+// maxFailures returns the failures tolerated before a reset
+func (opts *WatchdogOptions) maxFailures() int {
+	if opts.MaxFailures == 0 {
+		return defaultWatchdogFailures
+	}
+	return opts.MaxFailures
+}
+
+// probeLiveness checks the module answers AT, it runs inside the command loop
+func (Lora *lora) probeLiveness() error {
+	unsolicited := Lora.handleUnsolicited
+	_, err := probeCommand(Lora.port, Lora.reader, "AT", Lora.watchdog.timeout(), unsolicited)
+	return err
+}
+
+// awaitModule waits for the module to answer again after a reset, the +READY it reports is skipped
+func (Lora *lora) awaitModule() error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err = probeCommand(Lora.port, Lora.reader, "AT", Lora.watchdog.timeout(), nil); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// recoverModule escalates through AT+RESET, a reset pulse on RTS and a reconnect until the module answers,
+// reapplying the configuration afterwards. It runs inside the command loop, when the software reset fails
+// it lowers RTS and returns the cause so the loop can release the pin with finishHardReset once resetPulse
+// has passed, ok is false when the loop should exit
+func (Lora *lora) recoverModule(cause error) (pulseCause error, ok bool) {
+	timeout := Lora.watchdog.timeout()
+
+	// software reset, a wedged module may still act on it
+	Lora.emitLink(LinkEvent{State: LinkSoftReset, Err: cause})
+	_, err := probeCommand(Lora.port, Lora.reader, "AT+RESET", timeout, nil)
+	if err == nil {
+		err = Lora.awaitModule()
+	}
+	if err == nil {
+		err = Lora.reapplyConfig()
+	}
+	if err == nil {
+		Lora.emitLink(LinkEvent{State: LinkRestored})
+		return nil, true
+	}
+	cause = fmt.Errorf("software reset failed: %w", err)
+
+	// hardware reset through the reset pin, when the adapter wires RTS to it
+	if err := setTransportRTS(Lora.port, false); err == nil {
+		Lora.emitLink(LinkEvent{State: LinkHardReset, Err: cause})
+		return cause, true
+	}
+	return nil, Lora.abandonModule(cause)
+}
+
+// finishHardReset releases the reset pin after the pulse and waits for the module, it runs inside the
+// command loop and reports false when the loop should exit
+func (Lora *lora) finishHardReset(cause error) bool {
+	err := setTransportRTS(Lora.port, true)
+	if err == nil {
+		err = Lora.awaitModule()
+	}
+	if err == nil {
+		err = Lora.reapplyConfig()
+	}
+	if err == nil {
+		Lora.emitLink(LinkEvent{State: LinkRestored})
+		return true
+	}
+	return Lora.abandonModule(fmt.Errorf("hardware reset failed: %w", err))
+}
+
+// abandonModule reopens the link once both resets have failed, or reports the module as failed, it
+// reports false when the loop should exit
+func (Lora *lora) abandonModule(cause error) bool {
+	if Lora.reconnect != nil {
+		Lora.emitLink(LinkEvent{State: LinkLost, Err: cause})
+		return Lora.reconnectLink(cause)
+	}
+
+	// nothing left to try, the watchdog starts again after the next failures
+	Lora.emitLink(LinkEvent{State: LinkFailed, Err: cause})
+	return true
+}
@@ -0,0 +1,128 @@
+package krylr896
+
+import (
+	"testing"
+	"time"
+
+	"github.com/1kharvey/k-rylr896/emulator"
+)
+
+// linkStates collects link events until want has been seen or a timeout
+func linkStates(t *testing.T, lora *lora, until LinkState) []LinkState {
+	t.Helper()
+	var states []LinkState
+	for len(states) == 0 || states[len(states)-1] != until {
+		states = append(states, nextLinkEvent(t, lora).State)
+	}
+	return states
+}
+
+// sameStates reports whether two state sequences are equal
+func sameStates(a, b []LinkState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestWatchdogSoftReset checks that lost probe answers lead to AT+RESET and the configuration being reapplied
+func TestWatchdogSoftReset(t *testing.T) {
+	module := emulator.New()
+	// the first +OK answers the configuration, the next two are the probes
+	faults := NewFaultTransport(module.Attach(), 1,
+		FaultRule{Kind: FaultDropLine, Match: "+OK", Nth: 2},
+		FaultRule{Kind: FaultDropLine, Match: "+OK", Nth: 3})
+
+	address := uint16(9)
+	lora, err := CreateConnectionTransportWithOptions(faults, 0, Configuration{Address: &address}, 10, ConnectionOptions{
+		Watchdog: &WatchdogOptions{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond, MaxFailures: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.Close()
+
+	states := linkStates(t, lora, LinkRestored)
+	want := []LinkState{LinkConnected, LinkUnresponsive, LinkUnresponsive, LinkSoftReset, LinkRestored}
+	if !sameStates(states, want) {
+		t.Fatalf("got states %v, want %v", states, want)
+	}
+	if _, err := lora.SendCommand("AT+ADDRESS?"); err != nil {
+		t.Fatalf("command after recovery failed: %v", err.Err)
+	}
+}
+
+// TestWatchdogHardReset checks that a hung module is reset through RTS
+func TestWatchdogHardReset(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransportWithOptions(module.Attach(), 0, Configuration{}, 10, ConnectionOptions{
+		Watchdog: &WatchdogOptions{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond, MaxFailures: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.Close()
+
+	nextLinkEvent(t, lora)
+	module.Hang()
+
+	states := linkStates(t, lora, LinkRestored)
+	want := []LinkState{LinkUnresponsive, LinkSoftReset, LinkHardReset, LinkRestored}
+	if !sameStates(states, want) {
+		t.Fatalf("got states %v, want %v", states, want)
+	}
+	if _, err := lora.SendCommand("AT"); err != nil {
+		t.Fatalf("command after recovery failed: %v", err.Err)
+	}
+}
+
+// TestWatchdogResetPulseClose checks that Close does not wait for the reset pulse to end
+func TestWatchdogResetPulseClose(t *testing.T) {
+	module := emulator.New()
+	lora, err := CreateConnectionTransportWithOptions(module.Attach(), 0, Configuration{}, 10, ConnectionOptions{
+		Watchdog: &WatchdogOptions{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond, MaxFailures: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+
+	nextLinkEvent(t, lora)
+	module.Hang()
+	linkStates(t, lora, LinkHardReset)
+
+	start := time.Now()
+	lora.Close()
+	if elapsed := time.Since(start); elapsed >= resetPulse/2 {
+		t.Fatalf("Close took %v during a %v reset pulse", elapsed, resetPulse)
+	}
+}
+
+// TestWatchdogReconnect checks that a module that stays silent after both resets is reconnected
+func TestWatchdogReconnect(t *testing.T) {
+	module := emulator.New()
+	faults := NewFaultTransport(module.Attach(), 1, FaultRule{Kind: FaultDropLine, Match: "+OK"})
+	dial := func(int) (Transport, error) { return module.Attach(), nil }
+
+	lora, err := CreateConnectionTransportWithOptions(faults, 0, Configuration{}, 10, ConnectionOptions{
+		Watchdog:  &WatchdogOptions{Interval: 20 * time.Millisecond, Timeout: 30 * time.Millisecond, MaxFailures: 1},
+		Reconnect: &ReconnectOptions{Dial: dial, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create connection: %v", err.Err)
+	}
+	defer lora.Close()
+
+	states := linkStates(t, lora, LinkRestored)
+	want := []LinkState{LinkConnected, LinkUnresponsive, LinkSoftReset, LinkHardReset, LinkLost, LinkReconnecting, LinkRestored}
+	if !sameStates(states, want) {
+		t.Fatalf("got states %v, want %v", states, want)
+	}
+	if _, err := lora.SendCommand("AT"); err != nil {
+		t.Fatalf("command after reconnect failed: %v", err.Err)
+	}
+}